@@ -0,0 +1,135 @@
+package clog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// asyncQueue hands logs off to a background writer, so that logging never
+// blocks on i/o.  Logs are fully built (fields, caller, time) before they
+// get queued; only the encoding and writing happens in the background.
+type asyncQueue struct {
+	queue   chan asyncItem
+	dropped atomic.Int64
+
+	// guards the queue against getting closed while it's in use.
+	mu      sync.RWMutex
+	stopped bool
+	// closed once the background writer exits.
+	done chan struct{}
+}
+
+// asyncItem is either a log to write, or a drain request, which gets
+// closed once every log queued ahead of it is written.
+type asyncItem struct {
+	ce      *zapcore.CheckedEntry
+	drained chan struct{}
+}
+
+// newAsyncQueue starts the background writer.  Returns nil if size isn't
+// positive, in which case logs get written synchronously.
+func newAsyncQueue(size int) *asyncQueue {
+	if size <= 0 {
+		return nil
+	}
+
+	aq := &asyncQueue{
+		queue: make(chan asyncItem, size),
+		done:  make(chan struct{}),
+	}
+
+	go aq.run()
+
+	return aq
+}
+
+func (aq *asyncQueue) run() {
+	defer close(aq.done)
+
+	for item := range aq.queue {
+		if item.drained != nil {
+			close(item.drained)
+			continue
+		}
+
+		item.ce.Write()
+	}
+}
+
+// enqueue queues the log to get written.  Never blocks; if the queue is
+// full, the log gets dropped.  Once the queue is stopped, logs get written
+// immediately instead.  Returns false if the log won't get written, either
+// because it got dropped, or because the core didn't want it (a nil entry).
+func (aq *asyncQueue) enqueue(ce *zapcore.CheckedEntry) bool {
+	if ce == nil {
+		return false
+	}
+
+	aq.mu.RLock()
+	defer aq.mu.RUnlock()
+
+	if aq.stopped {
+		ce.Write()
+		return true
+	}
+
+	select {
+	case aq.queue <- asyncItem{ce: ce}:
+		return true
+	default:
+		aq.dropped.Add(1)
+		return false
+	}
+}
+
+// drain waits until every log queued so far has been written.
+func (aq *asyncQueue) drain() {
+	if aq == nil {
+		return
+	}
+
+	aq.mu.RLock()
+	defer aq.mu.RUnlock()
+
+	if aq.stopped {
+		return
+	}
+
+	drained := make(chan struct{})
+	aq.queue <- asyncItem{drained: drained}
+	<-drained
+}
+
+// stop writes out everything in the queue, and then shuts down the
+// background writer.  Safe to call more than once.
+func (aq *asyncQueue) stop() {
+	if aq == nil {
+		return
+	}
+
+	aq.mu.Lock()
+
+	if !aq.stopped {
+		aq.stopped = true
+		close(aq.queue)
+	}
+
+	aq.mu.Unlock()
+
+	<-aq.done
+}
+
+// DroppedLogs returns the number of logs dropped by the logger embedded in
+// the ctx (or the singleton) because its Settings.AsyncQueueSize queue was
+// full.  Always zero for loggers that write synchronously.
+func DroppedLogs(ctx context.Context) int64 {
+	aq := fromCtx(ctx).async
+	if aq == nil {
+		return 0
+	}
+
+	return aq.dropped.Load()
+}
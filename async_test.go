@@ -0,0 +1,306 @@
+package clog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/exp/slices"
+)
+
+type AsyncUnitSuite struct {
+	suite.Suite
+}
+
+func TestAsyncUnitSuite(t *testing.T) {
+	suite.Run(t, new(AsyncUnitSuite))
+}
+
+func (suite *AsyncUnitSuite) TestAsync_flushWritesEverything() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:         FormatToJSON,
+			AsyncQueueSize: 1000,
+		},
+		func(ctx context.Context) {
+			for i := 0; i < 100; i++ {
+				Ctx(ctx).With("i", i).Info("async")
+			}
+
+			assert.Zero(t, DroppedLogs(ctx))
+		})
+	require.Len(t, lines, 100)
+
+	for i, line := range lines {
+		log := jsonLine(t, line)
+		assert.EqualValues(t, i, log["i"], "logs keep their order")
+		assert.Contains(t, log["caller"], "async_test.go", "caller is resolved before queueing")
+	}
+}
+
+// blockingWriter holds up every write until it's released.
+type blockingWriter struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func (bw *blockingWriter) Write(p []byte) (int, error) {
+	<-bw.release
+
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	bw.lines = append(bw.lines, string(p))
+
+	return len(p), nil
+}
+
+func (suite *AsyncUnitSuite) TestAsync_dropsWhenFull() {
+	var (
+		t    = suite.T()
+		bw   = &blockingWriter{release: make(chan struct{})}
+		core = zapcore.NewCore(
+			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+			zapcore.AddSync(bw),
+			zapcore.DebugLevel)
+		ctx = plantLoggerInCtx(
+			context.Background(),
+			newClogger(zap.New(core).Sugar(), Settings{AsyncQueueSize: 1}))
+	)
+
+	// the first log may get picked up by the writer, which blocks, the
+	// next fills the queue, and the rest get dropped.  Logging never blocks.
+	for i := 0; i < 5; i++ {
+		Ctx(ctx).Info(fmt.Sprint("log ", i))
+	}
+
+	dropped := DroppedLogs(ctx)
+	assert.GreaterOrEqual(t, dropped, int64(3))
+
+	close(bw.release)
+	Flush(ctx)
+
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	assert.Len(t, bw.lines, 5-int(dropped), "everything that wasn't dropped gets written")
+	assert.True(t, strings.Contains(bw.lines[0], "log 0"), bw.lines[0])
+}
+
+// slowWriter takes a while to write each log, and records how many logs
+// it had written each time it got synced.
+type slowWriter struct {
+	mu          sync.Mutex
+	lines       int
+	linesAtSync []int
+}
+
+func (sw *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.lines++
+
+	return len(p), nil
+}
+
+func (sw *slowWriter) Sync() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.linesAtSync = append(sw.linesAtSync, sw.lines)
+
+	return nil
+}
+
+func (sw *slowWriter) synced() []int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	return slices.Clone(sw.linesAtSync)
+}
+
+func (suite *AsyncUnitSuite) TestAsync_flushAll() {
+	var (
+		t        = suite.T()
+		sw       = &slowWriter{}
+		ctx, zsl = InitWithWriter(
+			context.Background(),
+			Settings{Format: FormatToJSON, AsyncQueueSize: 10},
+			sw)
+	)
+
+	defer Release(zsl)
+
+	for i := 0; i < 5; i++ {
+		Ctx(ctx).Info("queued")
+	}
+
+	// other loggers in the process may fail to sync, ex: to stderr.
+	_ = FlushAll()
+
+	assert.Equal(t, []int{5}, sw.synced(), "the queue drains before the sync")
+}
+
+func (suite *AsyncUnitSuite) TestAsync_flushOnDone() {
+	var (
+		t           = suite.T()
+		sw          = &slowWriter{}
+		base, cnclr = context.WithCancel(context.Background())
+		ctx, zsl    = InitWithWriter(
+			base,
+			Settings{Format: FormatToJSON, AsyncQueueSize: 10},
+			sw)
+	)
+
+	defer Release(zsl)
+
+	stop := FlushOnDone(ctx)
+	defer stop()
+
+	for i := 0; i < 5; i++ {
+		Ctx(ctx).Info("queued")
+	}
+
+	cnclr()
+
+	require.Eventually(
+		t,
+		func() bool { return len(sw.synced()) > 0 },
+		time.Second,
+		10*time.Millisecond)
+	assert.Equal(t, 5, sw.synced()[0], "the queue drains before the sync")
+}
+
+func (suite *AsyncUnitSuite) TestAsync_stop() {
+	var (
+		t    = suite.T()
+		sw   = &slowWriter{}
+		core = zapcore.NewCore(
+			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+			zapcore.AddSync(sw),
+			zapcore.DebugLevel)
+		clgr = newClogger(zap.New(core).Sugar(), Settings{AsyncQueueSize: 10})
+		ctx  = plantLoggerInCtx(context.Background(), clgr)
+	)
+
+	Ctx(ctx).Info("queued")
+	clgr.async.stop()
+
+	select {
+	case <-clgr.async.done:
+	default:
+		assert.Fail(t, "the background writer exits")
+	}
+
+	sw.mu.Lock()
+	assert.Equal(t, 1, sw.lines, "queued logs get written before stopping")
+	sw.mu.Unlock()
+
+	// safe to stop twice, and to keep logging.
+	clgr.async.stop()
+	Ctx(ctx).Info("after the stop")
+	Flush(ctx)
+
+	sw.mu.Lock()
+	assert.Equal(t, 2, sw.lines, "stopped queues write synchronously")
+	sw.mu.Unlock()
+}
+
+func (suite *AsyncUnitSuite) TestAsync_droppedLogsArentCounted() {
+	var (
+		t      = suite.T()
+		onLogs atomic.Int64
+		bw     = &blockingWriter{release: make(chan struct{})}
+		core   = zapcore.NewCore(
+			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+			zapcore.AddSync(bw),
+			zapcore.DebugLevel)
+		set = Settings{
+			AsyncQueueSize: 1,
+			OnLog:          func(logLevel, []string) { onLogs.Add(1) },
+		}
+		clgr = newClogger(zap.New(core).Sugar(), set)
+		ctx  = plantLoggerInCtx(context.Background(), clgr)
+	)
+
+	for i := 0; i < 5; i++ {
+		Ctx(ctx).Info("log")
+	}
+
+	close(bw.release)
+	Flush(ctx)
+
+	delivered := 5 - DroppedLogs(ctx)
+	assert.Equal(t, delivered, onLogs.Load())
+	assert.Equal(t, delivered, clgr.counts.info.Load())
+}
+
+func (suite *AsyncUnitSuite) TestAsync_reusedBuilder() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:         FormatForHumans,
+			AsyncQueueSize: 1000,
+		},
+		func(ctx context.Context) {
+			b := Ctx(ctx)
+
+			// the builder keeps changing after each log gets queued.
+			for i := 0; i < 50; i++ {
+				b.
+					Tag("tag", fmt.Sprint("tag_", i)).
+					Commentf("note", "note_%d", i).
+					Group("grp", fmt.Sprint("grp_", i), i).
+					Group("grp.sub", "n", fmt.Sprint("sub_", i)).
+					Info("reused")
+			}
+		})
+	require.Len(t, lines, 50)
+
+	for i, line := range lines {
+		assert.Contains(t, line, fmt.Sprint("tag_", i), "tag")
+		assert.NotContains(t, line, fmt.Sprint("tag_", i+1), "later tag")
+		assert.Contains(t, line, fmt.Sprint("note_", i), "keyed comment")
+		assert.NotContains(t, line, fmt.Sprint("note_", i+1), "later keyed comment")
+		assert.Contains(t, line, fmt.Sprint("grp_", i), "group member")
+		assert.NotContains(t, line, fmt.Sprint("grp_", i+1), "later group member")
+		assert.Contains(t, line, fmt.Sprint("sub_", i), "nested group member")
+		assert.NotContains(t, line, fmt.Sprint("sub_", i+1), "later nested group member")
+	}
+}
+
+func (suite *AsyncUnitSuite) TestAsync_plantedLoggersAreSync() {
+	var (
+		t          = suite.T()
+		core, logs = observer.New(zapcore.DebugLevel)
+		ctx        = PlantLoggerWith(
+			context.Background(),
+			zap.New(core).Sugar(),
+			Settings{AsyncQueueSize: 1000})
+	)
+
+	assert.Nil(t, fromCtx(ctx).async, "no queue to leak")
+
+	Ctx(ctx).Info("planted")
+	assert.Equal(t, 1, logs.Len(), "written without a flush")
+}
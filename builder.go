@@ -2,12 +2,26 @@ package clog
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/alcionai/clues"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // ------------------------------------------------------------------------------------------------
@@ -19,12 +33,23 @@ import (
 // ------------------------------------------------------------------------------------------------
 
 type builder struct {
-	ctx             context.Context
-	err             error
-	zsl             *zap.SugaredLogger
-	with            map[any]any
-	labels          map[string]struct{}
-	comments        map[string]struct{}
+	ctx  context.Context
+	err  error
+	clgr *clogger
+	with map[string]any
+	// labels and comments are kept sorted and deduplicated as they're
+	// added, so that logging doesn't need to re-derive them every time.
+	// Never modified in place, since zap may still hold prior versions.
+	labels        []string
+	comments      []string
+	keyedComments map[string]string
+	tags          map[string]string
+	// the number of fields counted against Settings.MaxFieldsPerLog, and
+	// whether any got dropped for exceeding it.
+	nFields         int
+	fieldsTruncated bool
+	// additional files the log gets written to.
+	files           []string
 	skipCallerJumps int
 }
 
@@ -32,68 +57,343 @@ func newBuilder(ctx context.Context) *builder {
 	clgr := fromCtx(ctx)
 
 	return &builder{
-		ctx:      ctx,
-		zsl:      clgr.zsl,
-		with:     map[any]any{},
-		labels:   map[string]struct{}{},
-		comments: map[string]struct{}{},
+		ctx:           ctx,
+		clgr:          clgr,
+		labels:        ctxLabels(ctx),
+		with:          map[string]any{},
+		keyedComments: map[string]string{},
 	}
 }
 
 // log actually delivers the log to the underlying logger with the given
 func (b builder) log(l logLevel, msg string) {
-	cv := clues.In(b.ctx).Map()
-	zsl := b.zsl
+	// re-resolve the logger, in case the singleton got replaced after the
+	// builder was made.
+	b.clgr = fromCtx(b.ctx)
+
+	// skip all the work of building the log if it won't get delivered.
+	// Terminal logs always get delivered.
+	if !l.terminal() && !b.Enabled(l) {
+		return
+	}
+
+	if !l.terminal() && !b.clgr.smplr.keep(b.ctx, l, msg) {
+		return
+	}
+
+	// merge the fields from every source into one set, so that the
+	// enrichment hook can see (and change) everything that gets logged.
+	// terse error logs skip the ctx and error clues, so that end users
+	// only see the error itself.
+	terse := b.clgr.set.TerseErrors && (l == LevelError || l.terminal())
+
+	fields := map[string]any{}
+	if !terse {
+		fields = b.ctxFields()
+	}
+
+	switch {
+	case b.err == nil:
+	case terse:
+		fields["error"] = b.err
+	case b.clgr.set.NestErrors:
+		ev := clues.InErr(b.err).Map()
+		dropKeys(ev, b.clgr.set.DropKeys)
+
+		// keep the error's values apart from the context values.
+		fields["error"] = map[string]any{
+			"msg":    b.err.Error(),
+			"type":   errorType(b.err),
+			"labels": clues.Labels(b.err),
+			"clues":  ev,
+		}
+	default:
+		ev := clues.InErr(b.err).Map()
+
+		if b.clgr.set.PrefixSources {
+			dropKeys(ev, b.clgr.set.DropKeys)
+			ev = prefixKeys(ev, "err.")
+		}
 
-	if b.err != nil {
 		// error values should override context values.
-		maps.Copy(cv, clues.InErr(b.err).Map())
+		maps.Copy(fields, ev)
 
 		// attach the error and its labels
-		zsl = zsl.
-			With("error", b.err).
-			With("error_labels", clues.Labels(b.err))
+		fields["error"] = b.err
+		fields["error_type"] = errorType(b.err)
+		fields["error_labels"] = clues.Labels(b.err)
 	}
 
-	for k, v := range cv {
-		zsl = zsl.With(k, v)
-	}
+	dropKeys(fields, b.clgr.set.DropKeys)
 
 	// plus any values added using builder.With()
 	for k, v := range b.with {
-		zsl = zsl.With(k, v)
+		if slices.Contains(b.clgr.set.DropKeys, k) {
+			continue
+		}
+
+		if lz, ok := v.(lazy); ok {
+			v = getValue(lz())
+		}
+
+		if c, ok := v.(clues.Concealer); ok && slices.Contains(b.clgr.set.PIIAllowKeys, k) {
+			v = c.PlainString()
+		}
+
+		// the builder can keep adding to the group after this log, while
+		// the (possibly async) encoder is still reading it.
+		if g, ok := v.(group); ok {
+			v = g.clone()
+		}
+
+		fields[k] = v
 	}
 
-	// finally, make sure we attach the labels and comments
-	zsl = zsl.With("clog_labels", maps.Keys(b.labels))
-	zsl = zsl.With("clog_comments", maps.Keys(b.comments))
+	if b.fieldsTruncated {
+		fields["fields_truncated"] = true
+	}
+
+	if b.clgr.set.ShowElapsed {
+		fields["elapsed"] = time.Since(b.clgr.start)
+	}
+
+	// finally, make sure we attach the labels and comments.  Both are
+	// always sorted string arrays, never null, so that log processors
+	// can depend on the schema.
+	labels := b.labels
+
+	fields["clog_labels"] = nonNil(labels)
+	fields["clog_comments"] = nonNil(b.comments)
+
+	// same as groups, the builder's maps can change after this log.
+	if len(b.keyedComments) > 0 {
+		fields["clog_keyed_comments"] = maps.Clone(b.keyedComments)
+	}
+
+	if len(b.tags) > 0 {
+		fields["clog_tags"] = maps.Clone(b.tags)
+	}
+
+	if b.clgr.set.Enrich != nil {
+		fields = enrich(b.clgr.set.Enrich, fields)
+	}
+
+	kvs := make([]any, 0, 2*len(fields))
+
+	if b.clgr.set.SortKeys {
+		keys := maps.Keys(fields)
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			kvs = append(kvs, k, fields[k])
+		}
+	} else {
+		for k, v := range fields {
+			kvs = append(kvs, k, v)
+		}
+	}
+
+	zsl := b.clgr.zsl
+
+	if len(b.files) > 0 {
+		zsl = zsl.WithOptions(zap.WrapCore(b.teeFiles))
+	}
+
+	zsl = zsl.With(kvs...)
 
 	if b.skipCallerJumps > 0 {
 		zsl = zsl.WithOptions(zap.AddCallerSkip(b.skipCallerJumps))
 	}
 
-	// then write everything to the logger
-	switch l {
-	case LevelDebug:
-		var ok bool
+	// terminal logs never return, so they need to be counted up front.
+	if l.terminal() && b.clgr.set.OnLog != nil {
+		b.clgr.set.OnLog(l, labels)
+	}
 
-		for _, l := range cloggerton.set.OnlyLogDebugIfContainsLabel {
-			if _, match := b.labels[l]; match {
-				ok = true
-				break
+	if b.clgr.async != nil && !l.terminal() {
+		// async loggers hand the log off to get written in the background.
+		// Dropped logs don't count as delivered.
+		if !b.clgr.async.enqueue(zsl.Desugar().Check(zapLevel(l), msg)) {
+			return
+		}
+	} else {
+		// terminal logs never return, so anything still queued goes first.
+		b.clgr.async.drain()
+
+		// then write everything to the logger
+		switch l {
+		case LevelDebug:
+			zsl.Debug(msg)
+		case LevelInfo:
+			zsl.Info(msg)
+		case LevelError:
+			zsl.Error(msg)
+		case levelPanic:
+			zsl.
+				WithOptions(zap.WithPanicHook(flushThen{b.clgr.zsl, zapcore.WriteThenPanic})).
+				Panic(msg)
+		case levelFatal:
+			zsl.
+				WithOptions(zap.WithFatalHook(flushThen{b.clgr.zsl, exitHook{}})).
+				Fatal(msg)
+		}
+	}
+
+	b.clgr.counts.add(l, labels)
+
+	if !l.terminal() && b.clgr.set.OnLog != nil {
+		b.clgr.set.OnLog(l, labels)
+	}
+}
+
+// ctxFields produces the clues in the ctx, along with any ExtraCtxFields.
+func (b builder) ctxFields() map[string]any {
+	fields := clues.In(b.ctx).Map()
+
+	if b.clgr.set.ExtraCtxFields != nil {
+		// clues values win any collisions.
+		for k, v := range b.clgr.set.ExtraCtxFields(b.ctx) {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
 			}
 		}
+	}
+
+	if b.clgr.set.PrefixSources {
+		dropKeys(fields, b.clgr.set.DropKeys)
+		fields = prefixKeys(fields, "ctx.")
+	}
+
+	return fields
+}
+
+// errorType produces the go type of the error's root cause, ex: "*net.OpError",
+// so that errors can be grouped by type even when their messages vary.
+func errorType(err error) string {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return fmt.Sprintf("%T", err)
+		}
+
+		err = next
+	}
+}
+
+// enrich runs the Settings.Enrich hook over a copy of the fields.  If the
+// hook panics, the original fields get logged instead, along with the panic.
+// A hook that returns nil keeps whatever changes it made in place.
+func enrich(
+	fn func(map[string]any) map[string]any,
+	fields map[string]any,
+) (result map[string]any) {
+	defer func() {
+		if r := recover(); r != nil {
+			fields["clog_enrich_error"] = fmt.Sprint(r)
+			result = fields
+		}
+	}()
+
+	cp := maps.Clone(fields)
+
+	enriched := fn(cp)
+	if enriched == nil {
+		return cp
+	}
+
+	return enriched
+}
+
+// teeFiles adds the cores for the builder's files to the core.  Files that
+// can't be opened get skipped, so that the log still reaches the core.
+func (b builder) teeFiles(core zapcore.Core) zapcore.Core {
+	cores := []zapcore.Core{core}
+
+	for _, f := range b.files {
+		fc, err := b.clgr.fileCore(f)
+		if err != nil {
+			continue
+		}
+
+		cores = append(cores, fc)
+	}
+
+	return zapcore.NewTee(cores...)
+}
+
+// prefixKeys produces a copy of the map with the prefix added to each key.
+func prefixKeys(m map[string]any, prefix string) map[string]any {
+	pm := make(map[string]any, len(m))
+
+	for k, v := range m {
+		pm[prefix+k] = v
+	}
+
+	return pm
+}
+
+// dropKeys removes the keys from the map.
+func dropKeys(m map[string]any, keys []string) {
+	for _, k := range keys {
+		delete(m, k)
+	}
+}
+
+// Enabled reports whether a log at the given level would get delivered,
+// considering both the logger's level and the debug label filter (as
+// applied to the labels already added to the builder).  Good for skipping
+// the construction of expensive values, ex:
+//
+//	if clog.Ctx(ctx).Label(clog.APICall).Enabled(clog.LevelDebug) {
+//	  clog.Ctx(ctx).Label(clog.APICall).Debugw("response", "body", dump(resp))
+//	}
+func (b *builder) Enabled(l logLevel) bool {
+	if l == LevelDisabled {
+		return false
+	}
+
+	if !b.clgr.zsl.Desugar().Core().Enabled(zapLevel(l)) {
+		return false
+	}
+
+	if !b.meetsLabelLevels(l) {
+		return false
+	}
+
+	if l != LevelDebug || len(b.clgr.set.OnlyLogDebugIfContainsLabel) == 0 {
+		return true
+	}
+
+	for _, l := range b.clgr.set.OnlyLogDebugIfContainsLabel {
+		if _, match := slices.BinarySearch(b.labels, l); match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// meetsLabelLevels checks the level against the thresholds configured for
+// the builder's labels.  If the builder has more than one label with a
+// threshold, meeting any one of them is sufficient.  Logs without any
+// thresholded labels always pass.
+func (b *builder) meetsLabelLevels(l logLevel) bool {
+	var gated bool
 
+	for _, lbl := range b.labels {
+		threshold, ok := b.clgr.set.LabelLevels[lbl]
 		if !ok {
-			return
+			continue
 		}
 
-		zsl.Debug(msg)
-	case LevelInfo:
-		zsl.Info(msg)
-	case LevelError:
-		zsl.Error(msg)
+		if l.gte(threshold) {
+			return true
+		}
+
+		gated = true
 	}
+
+	return !gated
 }
 
 // Err attaches the error to the builder.
@@ -109,6 +409,18 @@ func (b *builder) Err(err error) *builder {
 	return b
 }
 
+// WithErrClues adds the clues values from the error to the log, as if they
+// were added through With.  Unlike Err, the error doesn't become the log's
+// error; good for including the details of a secondary error (ex: a failed
+// cleanup) without replacing the primary one.
+func (b *builder) WithErrClues(err error) *builder {
+	if err == nil {
+		return b
+	}
+
+	return b.WithMap(clues.InErr(err).Map())
+}
+
 // Label adds all of the appended labels to the error.
 // Adding labels is a great way to categorize your logs into broad scale
 // concepts like "configuration", "process kickoff", or "process conclusion".
@@ -119,12 +431,38 @@ func (b *builder) Err(err error) *builder {
 // overwhelming number of debug logs that we all know you produce, you
 // little overlogger, you.
 func (b *builder) Label(ls ...string) *builder {
-	if len(b.labels) == 0 {
-		b.labels = map[string]struct{}{}
+	for _, l := range ls {
+		b.labels = insertSorted(b.labels, l)
 	}
 
-	for _, l := range ls {
-		b.labels[l] = struct{}{}
+	return b
+}
+
+// WithContext swaps the builder's ctx, so that the log gets the clues of
+// the new ctx instead, ex: a ctx derived further along, with more clues.
+// Values, labels, and comments already added to the builder are kept, and
+// any labels added to the new ctx with WithLabels get added as well.  The
+// log goes to the logger embedded in the new ctx.
+func (b *builder) WithContext(ctx context.Context) *builder {
+	if ctx == nil {
+		return b
+	}
+
+	b.ctx = ctx
+
+	for _, l := range ctxLabels(ctx) {
+		b.labels = insertSorted(b.labels, l)
+	}
+
+	return b
+}
+
+// ToFile writes the log to the file, in addition to the logger's usual
+// outputs, ex: to keep an audit trail in a dedicated file.  The file uses
+// the logger's format and level, and stays open for future logs.
+func (b *builder) ToFile(path string) *builder {
+	if len(path) > 0 && !slices.Contains(b.files, path) {
+		b.files = append(slices.Clip(b.files), path)
 	}
 
 	return b
@@ -134,11 +472,73 @@ func (b *builder) Label(ls ...string) *builder {
 // the code to find the comment about this log case?  Add them into the log
 // itself!
 func (b *builder) Comment(cmnt string) *builder {
-	if len(b.comments) == 0 {
-		b.comments = map[string]struct{}{}
+	b.comments = insertSorted(b.comments, cmnt)
+	return b
+}
+
+// Labels returns a sorted copy of the labels added to the builder.
+func (b *builder) Labels() []string {
+	return slices.Clone(nonNil(b.labels))
+}
+
+// Comments returns a sorted copy of the comments added to the builder.
+func (b *builder) Comments() []string {
+	return slices.Clone(nonNil(b.comments))
+}
+
+// insertSorted produces a copy of the sorted slice with the value added,
+// or the original slice if it already contains the value.
+func insertSorted(sl []string, v string) []string {
+	i, found := slices.BinarySearch(sl, v)
+	if found {
+		return sl
 	}
 
-	b.comments[cmnt] = struct{}{}
+	// clipping forces the insert to copy into a new array.
+	return slices.Insert(slices.Clip(sl), i, v)
+}
+
+// nonNil ensures empty slices render as an empty array instead of null.
+func nonNil(sl []string) []string {
+	if sl == nil {
+		return []string{}
+	}
+
+	return sl
+}
+
+// Commentf adds a comment under the given key.  Where Comment lumps all of
+// its comments together, keyed comments render as an object, so that a
+// comment about one subject can be told apart from a comment about another.
+// Re-using a key replaces the prior comment.
+func (b *builder) Commentf(key, tmpl string, vs ...any) *builder {
+	if len(b.keyedComments) == 0 {
+		b.keyedComments = map[string]string{}
+	}
+
+	if _, ok := b.keyedComments[key]; !ok && !b.countField() {
+		return b
+	}
+
+	b.keyedComments[key] = fmt.Sprintf(tmpl, concealed(vs)...)
+
+	return b
+}
+
+// Tag adds a categorized tag to the log, ex: Tag("phase", "download").
+// Where labels only mark membership in a category, tags carry a value, and
+// render as a "clog_tags" object, apart from the "clog_labels".  Re-using
+// a key replaces the prior value.
+func (b *builder) Tag(key, value string) *builder {
+	if len(b.tags) == 0 {
+		b.tags = map[string]string{}
+	}
+
+	if _, ok := b.tags[key]; !ok && !b.countField() {
+		return b
+	}
+
+	b.tags[key] = value
 
 	return b
 }
@@ -153,6 +553,54 @@ func (b *builder) SkipCaller(nSkips int) *builder {
 	return b
 }
 
+// Recovered attaches the value returned by recover() under the "panic" key,
+// along with the current stack under "stacktrace".  When called within a
+// deferred func, that stack includes the site of the panic.  Does nothing
+// if r is nil, so it's safe to call unconditionally:
+//
+//	defer func() {
+//	  clog.Ctx(ctx).Recovered(recover()).Error("panic recovered")
+//	}()
+//
+// Careful: the above will log even when nothing panicked.  Check the
+// result of recover() first if you only want the log on panic.
+func (b *builder) Recovered(r any) *builder {
+	if r == nil {
+		return b
+	}
+
+	return b.With(
+		"panic", r,
+		"stacktrace", string(debug.Stack()))
+}
+
+// RecoverAndLog logs any panic at the error level, along with the panic
+// value and the stack, flushes the logger, and then re-panics with the same
+// value.  Panics with an error value also get the error's clues.  Call it
+// as the first defer in a goroutine, so that the panic can't escape without
+// a trace in the logs:
+//
+//	defer clog.RecoverAndLog(ctx)
+//
+// Does nothing if nothing panicked.
+func RecoverAndLog(ctx context.Context) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	b := Ctx(ctx)
+
+	if err, ok := r.(error); ok {
+		b = b.Err(err)
+	}
+
+	b.Recovered(r).Error("recovered from a panic")
+	Flush(ctx)
+
+	panic(r)
+}
+
 // getValue will return the value if not pointer, or the dereferenced
 // value if it is a pointer.
 func getValue(v any) any {
@@ -167,38 +615,438 @@ func getValue(v any) any {
 	return v
 }
 
+// concealed swaps any clues secrets in the message args for their concealed
+// text.  Messages get built before they reach the logger, so this is the only
+// chance we get to keep a secret interpolated into the message from landing
+// in the log as plain text, no matter how the secret implements fmt.Formatter.
+func concealed(vs []any) []any {
+	var cvs []any
+
+	for i, v := range vs {
+		c, ok := v.(clues.Concealer)
+		if !ok {
+			continue
+		}
+
+		if cvs == nil {
+			cvs = slices.Clone(vs)
+		}
+
+		cvs[i] = c.Conceal()
+	}
+
+	if cvs == nil {
+		return vs
+	}
+
+	return cvs
+}
+
+// the default for Settings.MaxFieldsPerLog.
+const defaultMaxFieldsPerLog = 1000
+
+// countField counts a new field against the builder's MaxFieldsPerLog.
+// If the builder is already full, the log gets marked as truncated instead,
+// and the field shouldn't get added.  Reports whether the field fits.
+func (b *builder) countField() bool {
+	maxFields := b.clgr.set.MaxFieldsPerLog
+	if maxFields <= 0 {
+		maxFields = defaultMaxFieldsPerLog
+	}
+
+	if b.nFields >= maxFields {
+		b.fieldsTruncated = true
+		return false
+	}
+
+	b.nFields++
+
+	return true
+}
+
+// setField adds the field to the builder, unless the builder already holds
+// the maximum number of fields.  Replacing an existing field is always
+// allowed.  Reports whether the field was set.
+func (b *builder) setField(k string, v any) bool {
+	if len(b.with) == 0 {
+		b.with = map[string]any{}
+	}
+
+	if _, ok := b.with[k]; !ok && !b.countField() {
+		return false
+	}
+
+	b.with[k] = v
+
+	return true
+}
+
+// fieldKey stringifies the key, since zap only accepts string keys.
+func fieldKey(k any) string {
+	if ks, ok := k.(string); ok {
+		return ks
+	}
+
+	return fmt.Sprint(k)
+}
+
 // With is your standard "With" func.  Add data in K:V pairs here to have them
 // added to the log message metadata.  Ex: builder.With("foo", "bar") will add
 // "foo": "bar" to the resulting log structure.  An uneven number of pairs will
-// give the last key a nil value.
+// give the last key a nil value.  Non-string keys get stringified.
 func (b *builder) With(vs ...any) *builder {
 	if len(vs) == 0 {
 		return b
 	}
 
-	if len(b.with) == 0 {
-		b.with = map[any]any{}
-	}
-
 	for i := 0; i < len(vs); i += 2 {
-		k := vs[i]
+		k := fieldKey(vs[i])
 		var v any
 
 		if (i + 1) < len(vs) {
 			v = vs[i+1]
 		}
 
-		b.with[k] = getValue(v)
+		b.setField(k, getValue(v))
+	}
+
+	return b
+}
+
+// Withf adds the K:V pair to the log, where the value is the formatted
+// string.  Ex: builder.Withf("range", "%d-%d", 1, 5) is the same as
+// builder.With("range", fmt.Sprintf("%d-%d", 1, 5)).
+func (b *builder) Withf(key, tmpl string, vs ...any) *builder {
+	return b.With(key, fmt.Sprintf(tmpl, concealed(vs)...))
+}
+
+// WithDuration adds the duration to the log twice: as a number of
+// milliseconds under the key, and as a human-readable string under the key
+// plus a "_human" suffix.  Ex: builder.WithDuration("took", 1200*time.Millisecond)
+// produces "took": 1200, "took_human": "1.2s".
+func (b *builder) WithDuration(key string, d time.Duration) *builder {
+	return b.With(
+		key, d.Milliseconds(),
+		key+"_human", d.String())
+}
+
+// WithJSON adds the pre-serialized json to the log as structured data,
+// ex: a webhook payload.  Json logs nest it as an object (or array, etc),
+// and human-readable logs render it compactly, instead of quoting it as a
+// string.  Invalid json gets added as a plain string, and the log gets
+// marked with "json_invalid": true.
+func (b *builder) WithJSON(key string, raw json.RawMessage) *builder {
+	if !json.Valid(raw) {
+		return b.With(
+			key, string(raw),
+			"json_invalid", true)
+	}
+
+	return b.With(key, rawJSON(raw))
+}
+
+// rawJSON marshals as-is.  Zap treats json.RawMessage as a string, since
+// it may implement fmt.Stringer, so the raw bytes need a type of their own.
+type rawJSON []byte
+
+func (rj rawJSON) MarshalJSON() ([]byte, error) {
+	return rj, nil
+}
+
+// WithSlice adds the length of the slice (or array) under the key plus a
+// "_len" suffix, and its first sampleN elements under the key plus a
+// "_sample" suffix, instead of the whole thing.  Good for slices that can
+// grow huge.  If sampleN isn't positive, only the length gets added.
+// Values that aren't slices or arrays get added under the key as-is.
+func (b *builder) WithSlice(key string, s any, sampleN int) *builder {
+	v := reflect.ValueOf(s)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return b.With(key, s)
+	}
+
+	b.With(key+"_len", v.Len())
+
+	if sampleN <= 0 {
+		return b
+	}
+
+	sample := make([]any, 0, min(sampleN, v.Len()))
+
+	for i := 0; i < cap(sample); i++ {
+		sample = append(sample, v.Index(i).Interface())
+	}
+
+	return b.With(key+"_sample", sample)
+}
+
+// BytesEncoding controls how WithBytes renders binary data.
+type BytesEncoding string
+
+const (
+	// log the bytes as a lowercase hex string.
+	BytesHex BytesEncoding = "hex"
+	// log the bytes as a standard base64 string.
+	BytesBase64 BytesEncoding = "base64"
+	// log only the number of bytes, never the bytes themselves.
+	BytesLen BytesEncoding = "len"
+)
+
+// maxLoggedBytes caps how much of a blob WithBytes will encode.
+const maxLoggedBytes = 1024
+
+// WithBytes adds the binary data to the log, rendered with the given
+// encoding, ex: a hash digest.  Only the first 1KiB gets encoded; longer
+// data also gets its full size added under the key plus a "_len" suffix.
+// BytesLen (or an unknown encoding) only adds the size, which is the safe
+// choice for data that could be megabytes long.
+func (b *builder) WithBytes(key string, bs []byte, encoding BytesEncoding) *builder {
+	var enc func([]byte) string
+
+	switch encoding {
+	case BytesHex:
+		enc = hex.EncodeToString
+	case BytesBase64:
+		enc = base64.StdEncoding.EncodeToString
+	default:
+		return b.With(key+"_len", len(bs))
+	}
+
+	if len(bs) <= maxLoggedBytes {
+		return b.With(key, enc(bs))
+	}
+
+	return b.With(
+		key, enc(bs[:maxLoggedBytes]),
+		key+"_len", len(bs))
+}
+
+// WithRuntimeStats adds a snapshot of the go runtime to the log, grouped
+// under "runtime": the number of goroutines, the bytes and objects
+// allocated on the heap, the bytes obtained from the os, and the number of
+// completed gc cycles.  Reading the stats briefly pauses the program, but
+// doesn't trigger a gc, so it's fine for the occasional diagnostic log;
+// avoid it in hot paths.
+func (b *builder) WithRuntimeStats() *builder {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return b.Group(
+		"runtime",
+		"goroutines", runtime.NumGoroutine(),
+		"heap_alloc_bytes", ms.HeapAlloc,
+		"heap_objects", ms.HeapObjects,
+		"sys_bytes", ms.Sys,
+		"num_gc", ms.NumGC)
+}
+
+// group is a set of fields nested under a common key.
+type group map[string]any
+
+// flatten produces a single-depth map of the group's fields, where the keys
+// of nested fields are joined by dots, and prefixed with the given key.
+func (g group) flatten(prefix string) map[string]any {
+	m := map[string]any{}
+
+	for k, v := range g {
+		key := prefix + "." + k
+
+		if sub, ok := v.(group); ok {
+			maps.Copy(m, sub.flatten(key))
+			continue
+		}
+
+		m[key] = v
+	}
+
+	return m
+}
+
+// clone produces a deep copy of the group, including any nested groups.
+func (g group) clone() group {
+	c := make(group, len(g))
+
+	for k, v := range g {
+		if sub, ok := v.(group); ok {
+			v = sub.clone()
+		}
+
+		c[k] = v
+	}
+
+	return c
+}
+
+// Group adds the K:V pairs to the log nested under the given name.  Ex:
+// builder.Group("http", "method", "GET", "status", 200) will produce
+// "http": {"method": "GET", "status": 200} in json logs, and the flattened
+// "http.method": "GET", "http.status": 200 in human-readable logs.
+// Groups compose: calling Group with the same name adds to the existing
+// group, and a dotted name like "http.request" nests one group inside
+// another.
+func (b *builder) Group(name string, kvs ...any) *builder {
+	path := strings.Split(name, ".")
+
+	g, ok := b.with[path[0]].(group)
+	if !ok {
+		g = group{}
+
+		if !b.setField(path[0], g) {
+			return b
+		}
+	}
+
+	// group members count against the MaxFieldsPerLog as well.
+	for _, p := range path[1:] {
+		sub, ok := g[p].(group)
+		if !ok {
+			if _, exists := g[p]; !exists && !b.countField() {
+				return b
+			}
+
+			sub = group{}
+			g[p] = sub
+		}
+
+		g = sub
+	}
+
+	for i := 0; i < len(kvs); i += 2 {
+		k := fieldKey(kvs[i])
+		var v any
+
+		if (i + 1) < len(kvs) {
+			v = kvs[i+1]
+		}
+
+		if _, ok := g[k]; !ok && !b.countField() {
+			continue
+		}
+
+		g[k] = getValue(v)
+	}
+
+	return b
+}
+
+// WithRequest adds a standard set of fields describing the http request,
+// grouped under "http": the method, path, query, remote ip, user agent,
+// and content length.  Query values get masked, since they commonly carry
+// tokens; only the parameter names are kept.  Headers are never included,
+// so credentials like the Authorization header can't leak.
+func (b *builder) WithRequest(r *http.Request) *builder {
+	if r == nil {
+		return b
+	}
+
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	kvs := []any{
+		"method", r.Method,
+		"remote_ip", ip,
+		"user_agent", r.UserAgent(),
+		"content_length", r.ContentLength,
+	}
+
+	if r.URL != nil {
+		kvs = append(kvs, "path", r.URL.Path)
+
+		if q := maskedQuery(r.URL.Query()); len(q) > 0 {
+			kvs = append(kvs, "query", q)
+		}
+	}
+
+	return b.Group("http", kvs...)
+}
+
+// APICall adds a standard set of fields describing an outbound api call,
+// grouped under "api_call": the method, the url, the response status, and
+// the latency (in milliseconds, plus a human-readable "latency_human").
+// Also adds the APICall label.  Query values and url passwords get masked,
+// since they commonly carry tokens.
+func (b *builder) APICall(
+	method, rawURL string,
+	status int,
+	latency time.Duration,
+) *builder {
+	return b.
+		Label(APICall).
+		Group(
+			"api_call",
+			"method", method,
+			"url", redactedURL(rawURL),
+			"status", status,
+			"latency", latency.Milliseconds(),
+			"latency_human", latency.String())
+}
+
+// redactedURL masks the url's query values and password.  Urls that can't
+// be parsed lose everything after the path, just in case.
+func redactedURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		path, _, _ := strings.Cut(rawURL, "?")
+		return path
+	}
+
+	if len(u.RawQuery) > 0 {
+		u.RawQuery = maskedQuery(u.Query())
+	}
+
+	return u.Redacted()
+}
+
+// maskedQuery re-encodes the query with all of its values masked.
+func maskedQuery(q url.Values) string {
+	masked := url.Values{}
+
+	for k, vs := range q {
+		for range vs {
+			masked.Add(k, "***")
+		}
+	}
+
+	// url encoding would escape the mask.
+	return strings.ReplaceAll(masked.Encode(), "%2A%2A%2A", "***")
+}
+
+// WithMap is With, but for K:V pairs that are already in a map.
+func (b *builder) WithMap(m map[string]any) *builder {
+	if len(m) == 0 {
+		return b
+	}
+
+	for k, v := range m {
+		b.setField(k, getValue(v))
 	}
 
 	return b
 }
 
+// lazy is a value that doesn't get produced until the log gets delivered.
+type lazy func() any
+
+// WithLazy adds the K:V pair to the log, where the value is only produced by
+// calling fn if the log actually gets delivered.  Good for values that are
+// expensive to build or stringify, ex: a dump of an entire request.  If the
+// log gets filtered out, fn is never called.
+func (b *builder) WithLazy(key string, fn func() any) *builder {
+	if fn == nil {
+		return b
+	}
+
+	b.setField(key, lazy(fn))
+
+	return b
+}
+
 // Debug level logging.  Whenever possible, you should add a debug category
 // label to the log, as that will help your org maintain fine grained control
 // of debug-level log filtering.
 func (b builder) Debug(msgArgs ...any) {
-	b.log(LevelDebug, fmt.Sprint(msgArgs...))
+	b.log(LevelDebug, fmt.Sprint(concealed(msgArgs)...))
 }
 
 // Debugf level logging.  Whenever possible, you should add a debug category
@@ -207,7 +1055,7 @@ func (b builder) Debug(msgArgs ...any) {
 // f is for format.
 // f is also for "Why?  Why are you using this?  Use Debugw instead, it's much better".
 func (b builder) Debugf(tmpl string, vs ...any) {
-	b.log(LevelDebug, fmt.Sprintf(tmpl, vs...))
+	b.log(LevelDebug, fmt.Sprintf(tmpl, concealed(vs)...))
 }
 
 // Debugw level logging.  Whenever possible, you should add a debug category
@@ -221,14 +1069,14 @@ func (b builder) Debugw(msg string, keyValues ...any) {
 
 // Info is your standard info log.  You know. For information.
 func (b builder) Info(msgArgs ...any) {
-	b.log(LevelInfo, fmt.Sprint(msgArgs...))
+	b.log(LevelInfo, fmt.Sprint(concealed(msgArgs)...))
 }
 
 // Infof is your standard info log.  You know. For information.
 // f is for format.
 // f is also for "Don't make bloated log messages, kids.  Use Infow instead.".
 func (b builder) Infof(tmpl string, vs ...any) {
-	b.log(LevelInfo, fmt.Sprintf(tmpl, vs...))
+	b.log(LevelInfo, fmt.Sprintf(tmpl, concealed(vs)...))
 }
 
 // Infow is your standard info log.  You know. For information.
@@ -243,7 +1091,7 @@ func (b builder) Infow(msg string, keyValues ...any) {
 // add an error to your info or debug logs.  Log levels are just a fake labeling
 // system, anyway.
 func (b builder) Error(msgArgs ...any) {
-	b.log(LevelError, fmt.Sprint(msgArgs...))
+	b.log(LevelError, fmt.Sprint(concealed(msgArgs)...))
 }
 
 // Error is an error level log.  It doesn't require an error, because there's no
@@ -253,7 +1101,7 @@ func (b builder) Error(msgArgs ...any) {
 // f is for format.
 // f is also for "Good developers know the value of using Errorw before Errorf."
 func (b builder) Errorf(tmpl string, vs ...any) {
-	b.log(LevelError, fmt.Sprintf(tmpl, vs...))
+	b.log(LevelError, fmt.Sprintf(tmpl, concealed(vs)...))
 }
 
 // Error is an error level log.  It doesn't require an error, because there's no
@@ -266,19 +1114,184 @@ func (b builder) Errorw(msg string, keyValues ...any) {
 	b.With(keyValues...).log(LevelError, msg)
 }
 
+// LogErr logs the builder's error at the error level, using the error's
+// message as the log message.  Saves repeating yourself, ex:
+// clog.CtxErr(ctx, err).Label(clog.FailureOrigin).LogErr().
+// If the builder doesn't have an error, it logs a warning instead.
+func (b builder) LogErr() {
+	if b.err == nil {
+		b.Label(Warning).log(LevelInfo, "clog LogErr called without an error")
+		return
+	}
+
+	b.log(LevelError, b.err.Error())
+}
+
+// Emit logs the builder's fields at the given level without a message of
+// its own, ex: to dump a snapshot of some state.  The message is the
+// builder's first label (labels are sorted), or "snapshot" if it has none.
+// Unknown levels don't log.
+func (b builder) Emit(l logLevel) {
+	if !l.valid() {
+		return
+	}
+
+	msg := "snapshot"
+	if len(b.labels) > 0 {
+		msg = b.labels[0]
+	}
+
+	b.log(l, msg)
+}
+
+// Assert logs the message at the error level if the condition is false.
+// Good for invariants that should never break, ex:
+// clog.Ctx(ctx).With("count", n).Assert(n >= 0, "negative count").
+// If Settings.AssertPanics is set, a failed assertion logs and panics
+// like Panic instead, so that broken invariants can't go unnoticed in
+// development and tests.
+func (b builder) Assert(cond bool, msg string) {
+	if cond {
+		return
+	}
+
+	if b.clgr.set.AssertPanics {
+		b.log(levelPanic, msg)
+		return
+	}
+
+	b.log(LevelError, msg)
+}
+
+// Panic logs the message, flushes the logger, and then panics with the
+// message.  The log always gets delivered, regardless of the level, label,
+// or sampling filters.
+func (b builder) Panic(msgArgs ...any) {
+	b.log(levelPanic, fmt.Sprint(concealed(msgArgs)...))
+}
+
+// Fatal logs the message, flushes the logger, and then exits the process
+// with a status of 1 by calling ExitFunc.  Deferred funcs don't run.  The
+// log always gets delivered, regardless of the level, label, or sampling
+// filters.
+func (b builder) Fatal(msgArgs ...any) {
+	b.log(levelFatal, fmt.Sprint(concealed(msgArgs)...))
+}
+
+// ExitFunc gets called by Fatal, after the log is flushed, to exit the
+// process.  Tests can swap it out to capture the exit code instead of
+// exiting, and apps can wrap it to release extra resources first.
+// Override it at your own risk: if the replacement returns, so does Fatal,
+// and the caller carries on as if nothing happened.  Not safe to change
+// while logging.
+var ExitFunc = os.Exit
+
+// exitHook exits through ExitFunc after the log gets written.
+type exitHook struct{}
+
+func (exitHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {
+	ExitFunc(1)
+}
+
+// flushThen syncs the logger before handing off to the next hook, so that
+// nothing gets lost when the next hook panics or exits.
+type flushThen struct {
+	zsl  *zap.SugaredLogger
+	next zapcore.CheckWriteHook
+}
+
+func (ft flushThen) OnWrite(ce *zapcore.CheckedEntry, fields []zapcore.Field) {
+	_ = ft.zsl.Sync()
+	ft.next.OnWrite(ce, fields)
+}
+
 // ------------------------------------------------------------------------------------------------
 // wrapper: io.writer
 // ------------------------------------------------------------------------------------------------
 
 // Writer is a wrapper that turns the logger embedded in
-// the given ctx into an io.Writer.  All logs are currently
-// info-level.
+// the given ctx into an io.Writer.  All logs are info-level,
+// unless ParseJSON is set and the line specifies its own level.
 type Writer struct {
 	Ctx context.Context
+	// ParseJSON treats each line written as a json object, such as
+	// the output of a subprocess that produces its own structured logs.
+	// The object's fields get added to the log, and its "msg" and "level"
+	// fields are used as the log's message and level.  Lines that aren't
+	// json objects get logged as-is.
+	ParseJSON bool
+	// FieldKey, if populated, logs the captured content as a field under
+	// this key, instead of as the message, ex: "stdout".  Json objects
+	// parsed with ParseJSON still use their own fields.
+	FieldKey string
+	// Message is the message used when the content gets logged under the
+	// FieldKey.  Defaults to "captured output".
+	Message string
 }
 
 // Write writes to the the Writer's clogger.
 func (w Writer) Write(p []byte) (int, error) {
-	Ctx(w.Ctx).log(LevelInfo, string(p))
+	w.write(string(p))
 	return len(p), nil
 }
+
+// WriteString writes to the Writer's clogger, skipping the []byte
+// conversion that io.WriteString would otherwise make.
+func (w Writer) WriteString(s string) (int, error) {
+	w.write(s)
+	return len(s), nil
+}
+
+func (w Writer) write(s string) {
+	if !w.ParseJSON {
+		w.writeRaw(s)
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		w.writeJSON(line)
+	}
+}
+
+// writeRaw logs the content as the message, or under the FieldKey.
+func (w Writer) writeRaw(s string) {
+	if len(w.FieldKey) == 0 {
+		Ctx(w.Ctx).log(LevelInfo, s)
+		return
+	}
+
+	msg := w.Message
+	if len(msg) == 0 {
+		msg = "captured output"
+	}
+
+	Ctx(w.Ctx).With(w.FieldKey, s).log(LevelInfo, msg)
+}
+
+// writeJSON logs the line's json fields, falling back to logging
+// the raw line if it isn't a json object.
+func (w Writer) writeJSON(line string) {
+	var (
+		fields = map[string]any{}
+		level  = LevelInfo
+	)
+
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		w.writeRaw(line)
+		return
+	}
+
+	if l, ok := fields["level"].(string); ok {
+		ll := logLevel(strings.ToLower(l))
+		if ll.valid() && ll != LevelDisabled {
+			level = ll
+		}
+
+		delete(fields, "level")
+	}
+
+	msg, _ := fields["msg"].(string)
+	delete(fields, "msg")
+
+	Ctx(w.Ctx).WithMap(fields).log(level, msg)
+}
@@ -0,0 +1,151 @@
+package clog
+
+import (
+	"os"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// env vars following the https://no-color.org and
+// https://bixense.com/clicolors conventions.
+const (
+	noColorEnv       = "NO_COLOR"
+	cliColorForceEnv = "CLICOLOR_FORCE"
+)
+
+// useColor decides whether human-readable output gets colorized.
+// Explicit settings win.  Otherwise NO_COLOR disables color, and
+// CLICOLOR_FORCE enables it.  If neither is set, we colorize only
+// when the destination is a terminal.
+func useColor(set Settings) bool {
+	switch set.Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	if len(os.Getenv(noColorEnv)) > 0 {
+		return false
+	}
+
+	if force := os.Getenv(cliColorForceEnv); len(force) > 0 && force != "0" {
+		return true
+	}
+
+	return isTerminal(set.File)
+}
+
+// isTerminal reports whether the log file (or stdout, or stderr) is a
+// terminal, judged by whether it's a character device.  Stdout redirected
+// into a file isn't a terminal, and a file path like /dev/tty is.
+// Swappable for tests, which never run on a terminal.
+var isTerminal = func(file string) bool {
+	var (
+		fi  os.FileInfo
+		err error
+	)
+
+	switch {
+	case file == Stdout:
+		fi, err = os.Stdout.Stat()
+	case file == Stderr:
+		fi, err = os.Stderr.Stat()
+	case strings.Contains(file, "://"):
+		return false
+	default:
+		fi, err = os.Stat(file)
+	}
+
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// levelEncoder picks the level encoder for human-readable output.
+func levelEncoder(set Settings) zapcore.LevelEncoder {
+	color := useColor(set)
+
+	switch {
+	case set.ShortLevels:
+		return namedLevelEncoder(set, shortLevelEncoder(color), color)
+	case color:
+		return namedLevelEncoder(set, zapcore.CapitalColorLevelEncoder, true)
+	default:
+		return namedLevelEncoder(set, zapcore.CapitalLevelEncoder, false)
+	}
+}
+
+// shortLevelEncoder renders each level as its first capital letter, ex:
+// "E" for error, and "F" for fatal.
+func shortLevelEncoder(color bool) zapcore.LevelEncoder {
+	return func(zl zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+		var short string
+
+		switch zl {
+		case zapcore.DPanicLevel:
+			// dpanic would otherwise read as debug.
+			short = "P"
+		default:
+			short = zl.CapitalString()[:1]
+		}
+
+		if color {
+			short = levelColor(zl) + short + ansiReset
+		}
+
+		enc.AppendString(short)
+	}
+}
+
+// namedLevelEncoder renders levels using the Settings.LevelNames.  Levels
+// without a name fall back to the base encoder.
+func namedLevelEncoder(
+	set Settings,
+	base zapcore.LevelEncoder,
+	color bool,
+) zapcore.LevelEncoder {
+	if len(set.LevelNames) == 0 {
+		return base
+	}
+
+	return func(zl zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+		name, ok := set.LevelNames[namedLevel(zl)]
+		if !ok {
+			base(zl, enc)
+			return
+		}
+
+		if color {
+			name = levelColor(zl) + name + ansiReset
+		}
+
+		enc.AppendString(name)
+	}
+}
+
+// namedLevel maps the zapcore level to the logLevel used to look up
+// its name.  Unlike fromZapLevel, panic and fatal keep their own names.
+func namedLevel(zl zapcore.Level) logLevel {
+	switch zl {
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return levelPanic
+	case zapcore.FatalLevel:
+		return levelFatal
+	default:
+		return fromZapLevel(zl)
+	}
+}
+
+// levelColor matches the colors used by zapcore.CapitalColorLevelEncoder.
+func levelColor(zl zapcore.Level) string {
+	switch {
+	case zl < zapcore.InfoLevel:
+		return ansiMagenta
+	case zl < zapcore.WarnLevel:
+		return ansiBlue
+	case zl < zapcore.ErrorLevel:
+		return ansiYellow
+	default:
+		return ansiRed
+	}
+}
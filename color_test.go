@@ -0,0 +1,275 @@
+package clog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zapcore"
+)
+
+type ColorUnitSuite struct {
+	suite.Suite
+}
+
+func TestColorUnitSuite(t *testing.T) {
+	suite.Run(t, new(ColorUnitSuite))
+}
+
+// encodeLevel renders the info level using the provided encoder.
+func encodeLevel(enc zapcore.LevelEncoder) string {
+	moe := zapcore.NewMapObjectEncoder()
+
+	_ = moe.AddArray("level", zapcore.ArrayMarshalerFunc(func(ae zapcore.ArrayEncoder) error {
+		enc(zapcore.InfoLevel, ae)
+		return nil
+	}))
+
+	return fmt.Sprint(moe.Fields["level"])
+}
+
+func (suite *ColorUnitSuite) TestLevelEncoder() {
+	table := []struct {
+		name       string
+		set        Settings
+		env        map[string]string
+		tty        bool
+		expectANSI bool
+	}{
+		{
+			name:       "stdout, no env",
+			set:        Settings{File: Stdout, Color: ColorAuto},
+			tty:        true,
+			expectANSI: true,
+		},
+		{
+			name:       "stdout redirected to a file, no env",
+			set:        Settings{File: Stdout, Color: ColorAuto},
+			expectANSI: false,
+		},
+		{
+			name:       "file, no env",
+			set:        Settings{File: "/tmp/clog.log", Color: ColorAuto},
+			expectANSI: false,
+		},
+		{
+			name:       "tty file, no env",
+			set:        Settings{File: "/dev/tty", Color: ColorAuto},
+			tty:        true,
+			expectANSI: true,
+		},
+		{
+			name:       "stdout, NO_COLOR",
+			set:        Settings{File: Stdout, Color: ColorAuto},
+			env:        map[string]string{noColorEnv: "1"},
+			tty:        true,
+			expectANSI: false,
+		},
+		{
+			name:       "file, CLICOLOR_FORCE",
+			set:        Settings{File: "/tmp/clog.log", Color: ColorAuto},
+			env:        map[string]string{cliColorForceEnv: "1"},
+			expectANSI: true,
+		},
+		{
+			name:       "file, CLICOLOR_FORCE=0",
+			set:        Settings{File: "/tmp/clog.log", Color: ColorAuto},
+			env:        map[string]string{cliColorForceEnv: "0"},
+			expectANSI: false,
+		},
+		{
+			name:       "stdout, NO_COLOR, explicit always",
+			set:        Settings{File: Stdout, Color: ColorAlways},
+			env:        map[string]string{noColorEnv: "1"},
+			expectANSI: true,
+		},
+		{
+			name:       "file, CLICOLOR_FORCE, explicit never",
+			set:        Settings{File: "/tmp/clog.log", Color: ColorNever},
+			env:        map[string]string{cliColorForceEnv: "1"},
+			expectANSI: false,
+		},
+	}
+
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			t := suite.T()
+
+			t.Setenv(noColorEnv, "")
+			t.Setenv(cliColorForceEnv, "")
+
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+
+			prev := isTerminal
+			isTerminal = func(string) bool { return test.tty }
+
+			defer func() { isTerminal = prev }()
+
+			lvl := encodeLevel(levelEncoder(test.set))
+			assert.Contains(t, lvl, "INFO")
+			assert.Equal(t, test.expectANSI, strings.Contains(lvl, "\x1b["), lvl)
+		})
+	}
+}
+
+func (suite *ColorUnitSuite) TestIsTerminal() {
+	t := suite.T()
+
+	t.Setenv(noColorEnv, "")
+	t.Setenv(cliColorForceEnv, "")
+
+	file := filepath.Join(t.TempDir(), "clog.log")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+
+	assert.False(t, isTerminal(file), "regular file")
+	assert.False(t, isTerminal("clogwriter://1"), "urls")
+
+	lines := logToFile(
+		t,
+		Settings{Format: FormatForHumans, Color: ColorAuto},
+		func(ctx context.Context) {
+			Ctx(ctx).With("foo", "bar").Error("plain")
+		})
+	require.Len(t, lines, 1)
+
+	assert.NotContains(t, lines[0], "\x1b[", "files aren't colorized")
+}
+
+func (suite *ColorUnitSuite) TestShortLevels() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:      FormatForHumans,
+			Level:       LevelDebug,
+			ShortLevels: true,
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Debug("debug")
+			Ctx(ctx).Info("info")
+			Ctx(ctx).Error("error")
+		})
+	require.Len(t, lines, 3)
+
+	assert.Contains(t, lines[0], "\tD\t")
+	assert.Contains(t, lines[1], "\tI\t")
+	assert.Contains(t, lines[2], "\tE\t")
+	assert.NotContains(t, lines[2], "ERROR")
+
+	lvl := encodeLevel(levelEncoder(Settings{ShortLevels: true, Color: ColorAlways}))
+	assert.Equal(t, "["+ansiBlue+"I"+ansiReset+"]", lvl, "colorized")
+}
+
+func (suite *ColorUnitSuite) TestColorizedFields() {
+	table := []struct {
+		name       string
+		color      colorMode
+		expectANSI bool
+	}{
+		{
+			name:       "always",
+			color:      ColorAlways,
+			expectANSI: true,
+		},
+		{
+			name:       "never",
+			color:      ColorNever,
+			expectANSI: false,
+		},
+	}
+
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			t := suite.T()
+
+			lines := logToFile(
+				t,
+				Settings{
+					Format: FormatForHumans,
+					Color:  test.color,
+				},
+				func(ctx context.Context) {
+					Ctx(ctx).With("foo", "bar").Info("colorful")
+					Ctx(ctx).With("foo", "bar").Error("colorful")
+				})
+			require.Len(t, lines, 2)
+
+			for _, line := range lines {
+				assert.Equal(t, test.expectANSI, strings.Contains(line, "\x1b["), line)
+
+				// isolate the fields from the time, level, and message.
+				fields := line[strings.Index(line, "{"):]
+
+				assert.Contains(t, fields, "foo")
+				assert.Contains(t, fields, "bar")
+				assert.Equal(t, test.expectANSI, strings.Contains(fields, ansiDim), "colorized keys: "+fields)
+			}
+
+			if test.expectANSI {
+				assert.Contains(t, lines[0], ansiBold+`"bar"`, "bright values")
+				assert.Contains(t, lines[1], ansiRed+`"bar"`, "error values are red")
+			}
+		})
+	}
+}
+
+func (suite *ColorUnitSuite) TestLevelNames() {
+	names := map[logLevel]string{
+		LevelError: "CRITICAL",
+	}
+
+	suite.Run("json", func() {
+		t := suite.T()
+
+		lines := logToFile(
+			t,
+			Settings{Format: FormatToJSON, LevelNames: names},
+			func(ctx context.Context) {
+				Ctx(ctx).Info("info")
+				Ctx(ctx).Error("error")
+			})
+		require.Len(t, lines, 2)
+
+		assert.Equal(t, "info", jsonLine(t, lines[0])["level"], "unmapped levels keep the default")
+		assert.Equal(t, "CRITICAL", jsonLine(t, lines[1])["level"])
+	})
+
+	suite.Run("human", func() {
+		t := suite.T()
+
+		lines := logToFile(
+			t,
+			Settings{Format: FormatForHumans, Color: ColorNever, LevelNames: names},
+			func(ctx context.Context) {
+				Ctx(ctx).Info("info")
+				Ctx(ctx).Error("error")
+			})
+		require.Len(t, lines, 2)
+
+		assert.Contains(t, lines[0], "\tINFO\t", "unmapped levels keep the default")
+		assert.Contains(t, lines[1], "\tCRITICAL\t")
+	})
+
+	suite.Run("human, colorized", func() {
+		t := suite.T()
+
+		lines := logToFile(
+			t,
+			Settings{Format: FormatForHumans, Color: ColorAlways, LevelNames: names},
+			func(ctx context.Context) {
+				Ctx(ctx).Error("error")
+			})
+		require.Len(t, lines, 1)
+
+		assert.Contains(t, lines[0], ansiRed+"CRITICAL"+ansiReset)
+	})
+}
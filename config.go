@@ -0,0 +1,129 @@
+package clog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alcionai/clues"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// SettingsFromJSON builds the settings from a json config blob, such as a
+// "clog" block embedded in an app's config file.  Keys match the Settings
+// field names, ignoring case, ex: {"level": "debug", "format": "json"}.
+// Durations are numbers of nanoseconds.  Fields that hold funcs or writers
+// can't be configured this way.  Enum values (levels, formats, etc) that
+// clog doesn't recognize produce an error, instead of silently falling back
+// to the defaults.  Defaults aren't applied; Init handles that as usual.
+func SettingsFromJSON(bs []byte) (Settings, error) {
+	var set Settings
+
+	if len(bytes.TrimSpace(bs)) == 0 {
+		return set, nil
+	}
+
+	if err := json.Unmarshal(bs, &set); err != nil {
+		return Settings{}, clues.Wrap(err, "parsing json settings")
+	}
+
+	if err := set.validateEnums(); err != nil {
+		return Settings{}, err
+	}
+
+	return set, nil
+}
+
+// SettingsFromYAML is the yaml equivalent of SettingsFromJSON, and follows
+// the same rules.
+func SettingsFromYAML(bs []byte) (Settings, error) {
+	var v any
+
+	if err := yaml.Unmarshal(bs, &v); err != nil {
+		return Settings{}, clues.Wrap(err, "parsing yaml settings")
+	}
+
+	if v == nil {
+		return Settings{}, nil
+	}
+
+	// round-trip through json, so that both formats match keys the same way.
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return Settings{}, clues.Wrap(err, "converting yaml settings")
+	}
+
+	return SettingsFromJSON(bs)
+}
+
+// validateEnums checks that every populated enum value is one clog knows.
+func (s Settings) validateEnums() error {
+	if err := validLevel("Level", s.Level); err != nil {
+		return err
+	}
+
+	if err := validLevel("StacktraceAt", s.StacktraceAt); err != nil {
+		return err
+	}
+
+	if err := validFormat("Format", s.Format); err != nil {
+		return err
+	}
+
+	colors := []colorMode{ColorAuto, ColorAlways, ColorNever}
+	if len(s.Color) > 0 && !slices.Contains(colors, s.Color) {
+		return invalidEnum("Color", s.Color, colors)
+	}
+
+	algs := []sensitiveInfoHandlingAlgo{ShowSensitiveInfoInPlainText, MaskSensitiveInfo, HashSensitiveInfo}
+	if len(s.SensitiveInfoHandling) > 0 && !slices.Contains(algs, s.SensitiveInfoHandling) {
+		return invalidEnum("SensitiveInfoHandling", s.SensitiveInfoHandling, algs)
+	}
+
+	for label, level := range s.LabelLevels {
+		if err := validLevel("LabelLevels."+label, level); err != nil {
+			return err
+		}
+	}
+
+	for level := range s.LevelNames {
+		if err := validLevel("LevelNames", level); err != nil {
+			return err
+		}
+	}
+
+	for i, sink := range s.Sinks {
+		if err := validLevel(fmt.Sprintf("Sinks[%d].Level", i), sink.Level); err != nil {
+			return err
+		}
+
+		if err := validFormat(fmt.Sprintf("Sinks[%d].Format", i), sink.Format); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validLevel(field string, level logLevel) error {
+	if len(level) == 0 || level.valid() {
+		return nil
+	}
+
+	return invalidEnum(field, level, []logLevel{LevelDebug, LevelInfo, LevelError, LevelDisabled})
+}
+
+func validFormat(field string, format logFormat) error {
+	formats := []logFormat{FormatForHumans, FormatToJSON, FormatToJSONArray}
+	if len(format) == 0 || slices.Contains(formats, format) || isCustomFormat(format) {
+		return nil
+	}
+
+	return invalidEnum(field, format, formats)
+}
+
+func invalidEnum[T ~string](field string, value T, valid []T) error {
+	return clues.New(fmt.Sprintf("invalid %s %q; expected one of %q", field, value, valid)).
+		With("setting", field)
+}
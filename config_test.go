@@ -0,0 +1,110 @@
+package clog
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigUnitSuite struct {
+	suite.Suite
+}
+
+func TestConfigUnitSuite(t *testing.T) {
+	suite.Run(t, new(ConfigUnitSuite))
+}
+
+func (suite *ConfigUnitSuite) TestSettingsFromJSON_roundTrip() {
+	t := suite.T()
+
+	set := Settings{
+		File:                  Stdout,
+		Format:                FormatToJSON,
+		Level:                 LevelDebug,
+		Color:                 ColorNever,
+		SensitiveInfoHandling: MaskSensitiveInfo,
+		DropKeys:              []string{"secret"},
+		StacktraceAt:          LevelError,
+		LabelLevels:           map[string]logLevel{"noisy": LevelError},
+		Sinks:                 []Sink{{File: Stderr, Format: FormatForHumans, Level: LevelInfo}},
+		Sampling:              Sampling{First: 3, Thereafter: 10, Tick: time.Second},
+	}
+
+	bs, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	result, err := SettingsFromJSON(bs)
+	require.NoError(t, err)
+	assert.Equal(t, set, result)
+}
+
+func (suite *ConfigUnitSuite) TestSettingsFromYAML() {
+	t := suite.T()
+
+	blob := `
+level: debug
+format: json
+dropKeys:
+  - secret
+labelLevels:
+  noisy: error
+sinks:
+  - file: stderr
+    level: info
+sampling:
+  first: 3
+`
+
+	set, err := SettingsFromYAML([]byte(blob))
+	require.NoError(t, err)
+
+	assert.Equal(t, LevelDebug, set.Level)
+	assert.Equal(t, FormatToJSON, set.Format)
+	assert.Equal(t, []string{"secret"}, set.DropKeys)
+	assert.Equal(t, map[string]logLevel{"noisy": LevelError}, set.LabelLevels)
+	assert.Equal(t, []Sink{{File: Stderr, Level: LevelInfo}}, set.Sinks)
+	assert.Equal(t, 3, set.Sampling.First)
+}
+
+func (suite *ConfigUnitSuite) TestSettingsFromJSON_empty() {
+	set, err := SettingsFromJSON(nil)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), Settings{}, set)
+
+	set, err = SettingsFromYAML([]byte("\n"))
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), Settings{}, set)
+}
+
+func (suite *ConfigUnitSuite) TestSettingsFromJSON_invalid() {
+	table := []struct {
+		name   string
+		blob   string
+		expect string
+	}{
+		{"malformed", `{"level":`, "parsing json settings"},
+		{"level", `{"level": "verbose"}`, `invalid Level "verbose"`},
+		{"format", `{"format": "xml"}`, `invalid Format "xml"`},
+		{"color", `{"color": "sometimes"}`, `invalid Color "sometimes"`},
+		{"pii", `{"sensitiveInfoHandling": "shred"}`, `invalid SensitiveInfoHandling "shred"`},
+		{"label level", `{"labelLevels": {"noisy": "loud"}}`, `invalid LabelLevels.noisy "loud"`},
+		{"sink level", `{"sinks": [{"level": "warn"}]}`, `invalid Sinks[0].Level "warn"`},
+	}
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			_, err := SettingsFromJSON([]byte(test.blob))
+			require.Error(suite.T(), err)
+			assert.Contains(suite.T(), err.Error(), test.expect)
+		})
+	}
+}
+
+func (suite *ConfigUnitSuite) TestSettingsFromYAML_invalidLevel() {
+	_, err := SettingsFromYAML([]byte("level: verbose\n"))
+	require.Error(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), `invalid Level "verbose"`)
+}
@@ -1,5 +1,12 @@
 package clog
 
+import (
+	"sync"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
 // Default / Example labels
 const (
 	// good for categorizing debugging-level api call info.
@@ -29,3 +36,59 @@ const (
 	// who needs a logging level when you can use a label instead?
 	Warning = "clabel_warning"
 )
+
+// ------------------------------------------------------------------------------------------------
+// label registry
+// ------------------------------------------------------------------------------------------------
+
+var (
+	labelsMu sync.RWMutex
+	// known labels, and a description of their intended use.
+	registeredLabels = map[string]string{
+		APICall:               "good for categorizing debugging-level api call info.",
+		AlarmOnThis:           "when you want your log to cause a lot of noise.",
+		Cleanup:               "for info about end-of-run resource cleanup.",
+		Configuration:         "for showcasing the runtime configuration of your app.",
+		EndOfRunResults:       "everything that you want to know about the process at the time of its conclusion.",
+		FailureOrigin:         "good for marking the the error logs that you need to review when debugging.",
+		IndividualItemDetails: "debug logging that includes info about every item handled in the process.",
+		ProgressTicker:        "logs that track the completion of long running processes.",
+		StartOfRun:            "the state of the application when you kick off a new process.",
+		Warning:               "who needs a logging level when you can use a label instead?",
+	}
+)
+
+// RegisterLabel adds the label to the set of known labels.  Registration
+// isn't required to use a label; it's a convenience for anyone who wants
+// to enumerate the labels your app produces, such as a UI that toggles
+// OnlyLogDebugIfContainsLabel.  Re-registering a label replaces its
+// description.
+func RegisterLabel(name, description string) {
+	labelsMu.Lock()
+	defer labelsMu.Unlock()
+
+	registeredLabels[name] = description
+}
+
+// RegisteredLabels returns the sorted set of all known labels, including
+// both the clog built-ins and any labels added with RegisterLabel.
+func RegisteredLabels() []string {
+	labelsMu.RLock()
+	defer labelsMu.RUnlock()
+
+	ls := maps.Keys(registeredLabels)
+	slices.Sort(ls)
+
+	return ls
+}
+
+// LabelDescription returns the description of a registered label.
+// Returns false if the label was never registered.
+func LabelDescription(name string) (string, bool) {
+	labelsMu.RLock()
+	defer labelsMu.RUnlock()
+
+	desc, ok := registeredLabels[name]
+
+	return desc, ok
+}
@@ -0,0 +1,47 @@
+package clog_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alcionai/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConstsUnitSuite struct {
+	suite.Suite
+}
+
+func TestConstsUnitSuite(t *testing.T) {
+	suite.Run(t, new(ConstsUnitSuite))
+}
+
+func (suite *ConstsUnitSuite) TestRegisterLabel() {
+	var (
+		t = suite.T()
+		// the registry is global, so each run needs a label of its own.
+		custom = fmt.Sprintf("clabel_custom_%d", time.Now().UnixNano())
+	)
+
+	ls := clog.RegisteredLabels()
+	assert.Contains(t, ls, clog.APICall, "built-in label")
+	assert.NotContains(t, ls, custom, "custom label")
+	assert.IsNonDecreasing(t, ls, "sorted labels")
+
+	clog.RegisterLabel(custom, "a label of my very own")
+
+	ls = clog.RegisteredLabels()
+	assert.Contains(t, ls, clog.APICall, "built-in label")
+	assert.Contains(t, ls, custom, "custom label")
+	assert.IsNonDecreasing(t, ls, "sorted labels")
+
+	desc, ok := clog.LabelDescription(custom)
+	require.True(t, ok, "custom label is registered")
+	assert.Equal(t, "a label of my very own", desc)
+
+	_, ok = clog.LabelDescription("clabel_unregistered")
+	assert.False(t, ok, "unregistered label")
+}
@@ -0,0 +1,55 @@
+package clog
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/alcionai/clues"
+)
+
+// DefaultCorrelationHeader is the header read by CorrelationMiddleware when
+// no other header is specified.
+const DefaultCorrelationHeader = "X-Correlation-ID"
+
+// the key under which the correlation id appears in logs.
+const correlationIDKey = "correlation_id"
+
+const correlationIDCtxKey loggingKey = "clog_correlation_id"
+
+// WithCorrelationID embeds the correlation id in the ctx.  Every log
+// produced from the ctx, or any of its children, carries the id as the
+// "correlation_id" field.  Unlike a request id, the correlation id usually
+// comes from outside the process, so that logs can be matched up across
+// services.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, correlationIDCtxKey, id)
+	return clues.Add(ctx, correlationIDKey, id)
+}
+
+// CorrelationID returns the correlation id embedded in the ctx, or an
+// empty string if the ctx doesn't have one.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDCtxKey).(string)
+	return id
+}
+
+// CorrelationMiddleware produces http middleware that reads the correlation
+// id from the request's header, and embeds it in the request's ctx so that
+// it appears in every log for the request.  If the request doesn't have the
+// header, a new id gets minted.  Either way, the id gets echoed back in the
+// same header on the response.  If the header is empty, the
+// DefaultCorrelationHeader gets used.
+func CorrelationMiddleware(header string) func(http.Handler) http.Handler {
+	header = first(header, DefaultCorrelationHeader)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := first(r.Header.Get(header), newRequestID())
+
+			w.Header().Set(header, id)
+
+			ctx := WithCorrelationID(r.Context(), id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
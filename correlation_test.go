@@ -0,0 +1,93 @@
+package clog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CorrelationUnitSuite struct {
+	suite.Suite
+}
+
+func TestCorrelationUnitSuite(t *testing.T) {
+	suite.Run(t, new(CorrelationUnitSuite))
+}
+
+func (suite *CorrelationUnitSuite) TestCorrelationMiddleware() {
+	table := []struct {
+		name     string
+		header   string
+		inbound  string
+		expectID func(t *testing.T, id string)
+	}{
+		{
+			name:    "inbound id, default header",
+			inbound: "abc-123",
+			expectID: func(t *testing.T, id string) {
+				assert.Equal(t, "abc-123", id)
+			},
+		},
+		{
+			name:    "inbound id, custom header",
+			header:  "traceparent",
+			inbound: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expectID: func(t *testing.T, id string) {
+				assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", id)
+			},
+		},
+		{
+			name: "no inbound id",
+			expectID: func(t *testing.T, id string) {
+				assert.NotEmpty(t, id, "an id gets minted")
+			},
+		},
+	}
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			var (
+				t         = suite.T()
+				ctx, logs = observedCtx(context.Background())
+				header    = first(test.header, DefaultCorrelationHeader)
+				seenID    string
+			)
+
+			nested := func(ctx context.Context) {
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel()
+
+				Ctx(ctx).Info("nested")
+			}
+
+			handler := CorrelationMiddleware(test.header)(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					seenID = CorrelationID(r.Context())
+
+					Ctx(r.Context()).Info("handler")
+					nested(r.Context())
+				}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			if len(test.inbound) > 0 {
+				r.Header.Set(header, test.inbound)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			test.expectID(t, seenID)
+			assert.Equal(t, seenID, w.Header().Get(header), "echoed on the response")
+
+			require.Equal(t, 2, logs.Len())
+
+			for _, l := range logs.All() {
+				assert.Equal(t, seenID, l.ContextMap()[correlationIDKey], l.Message)
+			}
+		})
+	}
+}
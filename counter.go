@@ -0,0 +1,57 @@
+package clog
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Counter tallies repeated events, so that they can be reported in a
+// single summary log instead of one log per event, ex:
+//
+//	cnt := clog.NewCounter(ctx, "items_processed")
+//	for _, item := range items {
+//	  process(item)
+//	  cnt.Inc()
+//	}
+//	cnt.LogSummary("processed items")
+//
+// Safe for concurrent use.
+type Counter struct {
+	ctx   context.Context
+	label string
+	n     atomic.Int64
+}
+
+// NewCounter produces a counter that logs its summary using the ctx's
+// logger and clues.  The label gets added to the summary log.
+func NewCounter(ctx context.Context, label string) *Counter {
+	return &Counter{
+		ctx:   ctx,
+		label: label,
+	}
+}
+
+// Inc adds one to the count.
+func (c *Counter) Inc() {
+	c.n.Add(1)
+}
+
+// Add adds n to the count.
+func (c *Counter) Add(n int64) {
+	c.n.Add(n)
+}
+
+// Count returns the current count.
+func (c *Counter) Count() int64 {
+	return c.n.Load()
+}
+
+// LogSummary logs the message at the info level, with the counter's label,
+// and the current count in the "count" field.
+func (c *Counter) LogSummary(msg string) {
+	Ctx(c.ctx).
+		Label(c.label).
+		With("count", c.n.Load()).
+		SkipCaller(1).
+		Info(msg)
+}
@@ -0,0 +1,69 @@
+package clog
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CounterUnitSuite struct {
+	suite.Suite
+}
+
+func TestCounterUnitSuite(t *testing.T) {
+	suite.Run(t, new(CounterUnitSuite))
+}
+
+func (suite *CounterUnitSuite) TestCounter() {
+	var (
+		t         = suite.T()
+		ctx, logs = observedCtx(context.Background())
+		cnt       = NewCounter(ctx, "items_processed")
+		wg        sync.WaitGroup
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				cnt.Inc()
+			}
+
+			cnt.Add(5)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int64(1050), cnt.Count())
+
+	cnt.LogSummary("processed items")
+
+	require.Equal(t, 1, logs.Len())
+
+	log := logs.All()[0]
+	assert.Equal(t, "processed items", log.Message)
+	assert.Equal(t, int64(1050), log.ContextMap()["count"])
+	assert.Equal(t, []any{"items_processed"}, log.ContextMap()["clog_labels"])
+}
+
+func (suite *CounterUnitSuite) TestCounter_caller() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{Format: FormatToJSON},
+		func(ctx context.Context) {
+			NewCounter(ctx, "items_processed").LogSummary("processed items")
+		})
+	require.Len(t, lines, 1)
+
+	assert.Contains(t, jsonLine(t, lines[0])["caller"], "counter_test.go")
+}
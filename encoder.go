@@ -0,0 +1,296 @@
+package clog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/alcionai/clues"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// ansi escape codes used to colorize fields and levels.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+)
+
+var bufPool = buffer.NewPool()
+
+// humanOptions configures the rendering of human-readable logs.
+type humanOptions struct {
+	// colorize the field keys and values.
+	color bool
+	// print complex values across multiple indented lines.
+	pretty bool
+}
+
+var (
+	humanEncodingsMu sync.Mutex
+	humanEncodings   = map[humanOptions]string{}
+)
+
+// humanEncoding produces the name of the zap encoding that renders
+// human-readable logs with the given options, registering the encoding
+// with zap the first time those options are seen.
+func humanEncoding(opts humanOptions) (string, error) {
+	humanEncodingsMu.Lock()
+	defer humanEncodingsMu.Unlock()
+
+	if name, ok := humanEncodings[opts]; ok {
+		return name, nil
+	}
+
+	name := fmt.Sprintf("clog_human_color=%t_pretty=%t", opts.color, opts.pretty)
+
+	err := zap.RegisterEncoder(name, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newHumanEncoder(cfg, opts), nil
+	})
+	if err != nil {
+		return "", clues.Wrap(err, "registering human-readable encoder")
+	}
+
+	humanEncodings[opts] = name
+
+	return name, nil
+}
+
+// humanEncoder renders the same tab-separated rows as zap's console encoder:
+// the time, level, caller and message, followed by an object of fields.
+// Unlike the console encoder, it keeps the message safe from log forgery
+// (a message containing newlines or terminal escapes could otherwise fake
+// additional rows), sorts the fields by key, and can colorize them.
+type humanEncoder struct {
+	// collects the fields added through With().
+	*zapcore.MapObjectEncoder
+	// renders everything except the fields.
+	console zapcore.Encoder
+	cfg     zapcore.EncoderConfig
+	opts    humanOptions
+}
+
+func newHumanEncoder(cfg zapcore.EncoderConfig, opts humanOptions) *humanEncoder {
+	return &humanEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		console:          zapcore.NewConsoleEncoder(cfg),
+		cfg:              cfg,
+		opts:             opts,
+	}
+}
+
+func (he *humanEncoder) Clone() zapcore.Encoder {
+	moe := zapcore.NewMapObjectEncoder()
+	maps.Copy(moe.Fields, he.Fields)
+
+	return &humanEncoder{
+		MapObjectEncoder: moe,
+		console:          he.console,
+		cfg:              he.cfg,
+		opts:             he.opts,
+	}
+}
+
+func (he *humanEncoder) EncodeEntry(
+	ent zapcore.Entry,
+	fields []zapcore.Field,
+) (*buffer.Buffer, error) {
+	stack := ent.Stack
+
+	ent.Message = sanitize(ent.Message)
+	ent.Stack = ""
+
+	prefix, err := he.console.EncodeEntry(ent, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	lineEnding := he.cfg.LineEnding
+	if len(lineEnding) == 0 {
+		lineEnding = zapcore.DefaultLineEnding
+	}
+
+	line := bufPool.Get()
+	line.Write(bytes.TrimSuffix(prefix.Bytes(), []byte(lineEnding)))
+	prefix.Free()
+
+	all := he.Fields
+
+	if len(fields) > 0 {
+		moe := zapcore.NewMapObjectEncoder()
+		maps.Copy(moe.Fields, he.Fields)
+
+		for _, f := range fields {
+			f.AddTo(moe)
+		}
+
+		all = moe.Fields
+	}
+
+	if len(all) > 0 {
+		line.AppendString(he.separator())
+		he.writeFields(line, all, ent.Level)
+	}
+
+	if len(stack) > 0 && len(he.cfg.StacktraceKey) > 0 {
+		line.AppendByte('\n')
+		line.AppendString(stack)
+	}
+
+	line.AppendString(lineEnding)
+
+	return line, nil
+}
+
+func (he *humanEncoder) separator() string {
+	if len(he.cfg.ConsoleSeparator) == 0 {
+		return "\t"
+	}
+
+	return he.cfg.ConsoleSeparator
+}
+
+// writeFields renders the fields as an object sorted by key, ex:
+// {"bar": 1, "foo": "baz"}
+func (he *humanEncoder) writeFields(
+	line *buffer.Buffer,
+	fields map[string]any,
+	level zapcore.Level,
+) {
+	fields = flattenGroups(fields)
+
+	keys := maps.Keys(fields)
+	slices.Sort(keys)
+
+	valColor := ansiBold
+	if level >= zapcore.ErrorLevel {
+		valColor = ansiRed
+	}
+
+	line.AppendByte('{')
+
+	for i, k := range keys {
+		if i > 0 {
+			line.AppendString(", ")
+		}
+
+		v := marshalValue(fields[k])
+
+		if he.opts.pretty {
+			v = indent(v)
+		}
+
+		he.colorize(line, ansiDim, marshalValue(k))
+		line.AppendString(": ")
+		he.colorize(line, valColor, v)
+	}
+
+	line.AppendByte('}')
+}
+
+// flattenGroups replaces each group in the fields with its dotted keys,
+// ex: {"http": {"method": "GET"}} becomes {"http.method": "GET"}.  Groups
+// get flattened by the encoder, rather than the builder, so that every sink
+// receives the same fields, regardless of its format.
+func flattenGroups(fields map[string]any) map[string]any {
+	flat := make(map[string]any, len(fields))
+
+	for k, v := range fields {
+		if g, ok := v.(group); ok {
+			maps.Copy(flat, g.flatten(k))
+			continue
+		}
+
+		flat[k] = v
+	}
+
+	return flat
+}
+
+func (he *humanEncoder) colorize(line *buffer.Buffer, color, s string) {
+	if !he.opts.color {
+		line.AppendString(s)
+		return
+	}
+
+	line.AppendString(color)
+	line.AppendString(s)
+	line.AppendString(ansiReset)
+}
+
+// marshalValue renders the value as json, falling back to a quoted
+// string for values that can't be marshaled.  Control characters
+// always get escaped.
+func marshalValue(v any) string {
+	switch tv := v.(type) {
+	case time.Duration:
+		v = tv.String()
+	case time.Time:
+		v = tv.Format(time.RFC3339Nano)
+	}
+
+	var (
+		bb  bytes.Buffer
+		enc = json.NewEncoder(&bb)
+	)
+
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(v); err != nil {
+		return strconv.Quote(fmt.Sprintf("%+v", v))
+	}
+
+	return strings.TrimSuffix(bb.String(), "\n")
+}
+
+// indent spreads json objects and arrays across multiple indented lines.
+// Scalars and empty objects or arrays are left as-is.
+func indent(v string) string {
+	if len(v) <= 2 || (v[0] != '{' && v[0] != '[') {
+		return v
+	}
+
+	var bb bytes.Buffer
+
+	if err := json.Indent(&bb, []byte(v), "  ", "  "); err != nil {
+		return v
+	}
+
+	return bb.String()
+}
+
+// sanitize escapes all control characters (newlines, tabs, terminal
+// escape sequences, etc) within the string.
+func sanitize(s string) string {
+	if !strings.ContainsFunc(s, unicode.IsControl) {
+		return s
+	}
+
+	var sb strings.Builder
+
+	for _, r := range s {
+		if !unicode.IsControl(r) {
+			sb.WriteRune(r)
+			continue
+		}
+
+		// strip the surrounding single quotes
+		q := strconv.QuoteRune(r)
+		sb.WriteString(q[1 : len(q)-1])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,223 @@
+package clog
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alcionai/clues"
+	"go.uber.org/zap"
+)
+
+// the zap sink scheme used for log files.
+const fileScheme = "clogfile"
+
+// every file sink that's currently open, so that they can get reopened.
+var (
+	openFilesMu sync.Mutex
+	openFiles   = map[*fileSink]struct{}{}
+)
+
+func init() {
+	err := zap.RegisterSink(fileScheme, func(u *url.URL) (zap.Sink, error) {
+		return newFileSink(filePath(u))
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// outputPath produces the zap output path for the configured file.
+func outputPath(set Settings) string {
+	if set.File == Stdout ||
+		set.File == Stderr ||
+		// already a url, ex: a writer sink, or a file:// path.
+		strings.Contains(set.File, "://") {
+		return set.File
+	}
+
+	abs, err := filepath.Abs(set.File)
+	if err != nil {
+		return set.File
+	}
+
+	u := url.URL{
+		Scheme: fileScheme,
+		Path:   urlPath(abs),
+	}
+
+	if set.Format == FormatToJSONArray {
+		u.Scheme = jsonArrayScheme
+	}
+
+	return u.String()
+}
+
+// urlPath converts the absolute file path into a url path.  Paths that
+// start with a volume (ex: C:\logs\clog.log on windows) get a leading
+// slash, otherwise the volume gets parsed as the url's host.
+func urlPath(abs string) string {
+	p := filepath.ToSlash(abs)
+
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+
+	return p
+}
+
+// filePath is the inverse of urlPath: it produces the file path for a
+// sink url.
+func filePath(u *url.URL) string {
+	p := u.Path
+
+	if strings.HasPrefix(p, "/") && len(filepath.VolumeName(p[1:])) > 0 {
+		p = p[1:]
+	}
+
+	return filepath.FromSlash(p)
+}
+
+// fileSink appends logs to a file, and can reopen the file if something
+// (ex: logrotate) moves it out from under us.
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &fileSink{path: path, f: f}
+
+	openFilesMu.Lock()
+	openFiles[fs] = struct{}{}
+	openFilesMu.Unlock()
+
+	return fs, nil
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o666)
+}
+
+func (fs *fileSink) Write(p []byte) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.f.Write(p)
+}
+
+func (fs *fileSink) Sync() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.f.Sync()
+}
+
+func (fs *fileSink) Close() error {
+	openFilesMu.Lock()
+	delete(openFiles, fs)
+	openFilesMu.Unlock()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.f.Close()
+}
+
+// reopen swaps the file handle for a fresh one at the same path.
+func (fs *fileSink) reopen() error {
+	f, err := openLogFile(fs.path)
+	if err != nil {
+		return clues.Wrap(err, "reopening log file").With("log_file", fs.path)
+	}
+
+	fs.mu.Lock()
+	old := fs.f
+	fs.f = f
+	fs.mu.Unlock()
+
+	_ = old.Sync()
+
+	return old.Close()
+}
+
+// ReopenLogFile closes and reopens the log files configured for the
+// singleton: the File, plus the files of any Sinks.  Use it to cooperate
+// with external log rotation, ex: logrotate moves the file, then signals
+// the process to reopen it:
+//
+//	sigs := make(chan os.Signal, 1)
+//	signal.Notify(sigs, syscall.SIGHUP)
+//
+//	go func() {
+//	  for range sigs {
+//	    if err := clog.ReopenLogFile(); err != nil {
+//	      clog.Ctx(ctx).Err(err).Error("reopening log file")
+//	    }
+//	  }
+//	}()
+//
+// Files written in the json array format don't get reopened.
+func ReopenLogFile() error {
+	singleMu.Lock()
+
+	if cloggerton == nil {
+		singleMu.Unlock()
+		return nil
+	}
+
+	paths := map[string]struct{}{}
+
+	for _, set := range append([]Settings{cloggerton.set}, sinkSettings(cloggerton.set)...) {
+		u, err := url.Parse(outputPath(set))
+		if err == nil && u.Scheme == fileScheme {
+			paths[filePath(u)] = struct{}{}
+		}
+	}
+
+	singleMu.Unlock()
+
+	openFilesMu.Lock()
+
+	var files []*fileSink
+
+	for fs := range openFiles {
+		if _, ok := paths[fs.path]; ok {
+			files = append(files, fs)
+		}
+	}
+
+	openFilesMu.Unlock()
+
+	var errs []error
+
+	for _, fs := range files {
+		if err := fs.reopen(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return clues.Stack(errs...).OrNil()
+}
+
+// sinkSettings produces the settings for each of the sinks, excluding
+// writer sinks.
+func sinkSettings(set Settings) []Settings {
+	sets := make([]Settings, 0, len(set.Sinks))
+
+	for _, sink := range set.Sinks {
+		if sink.Writer == nil {
+			sets = append(sets, sink.settings(set))
+		}
+	}
+
+	return sets
+}
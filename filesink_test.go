@@ -0,0 +1,52 @@
+package clog
+
+import (
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type FileSinkUnitSuite struct {
+	suite.Suite
+}
+
+func TestFileSinkUnitSuite(t *testing.T) {
+	suite.Run(t, new(FileSinkUnitSuite))
+}
+
+func (suite *FileSinkUnitSuite) TestOutputPath_roundTrip() {
+	var (
+		t    = suite.T()
+		file = filepath.Join(t.TempDir(), "clog.log")
+	)
+
+	for _, format := range []logFormat{FormatToJSON, FormatToJSONArray} {
+		u, err := url.Parse(outputPath(Settings{File: file, Format: format}))
+		require.NoError(t, err, format)
+
+		assert.Empty(t, u.Host, format)
+		assert.Equal(t, file, filePath(u), format)
+	}
+}
+
+func (suite *FileSinkUnitSuite) TestOutputPath_volume() {
+	t := suite.T()
+
+	out := url.URL{Scheme: fileScheme, Path: urlPath(`C:/logs/clog.log`)}
+	assert.Equal(t, "clogfile:///C:/logs/clog.log", out.String())
+
+	u, err := url.Parse(out.String())
+	require.NoError(t, err)
+
+	assert.Empty(t, u.Host, "the volume isn't parsed as the host")
+	assert.Equal(t, "/C:/logs/clog.log", u.Path)
+
+	if runtime.GOOS == "windows" {
+		assert.Equal(t, `C:\logs\clog.log`, filePath(u))
+	}
+}
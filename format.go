@@ -0,0 +1,59 @@
+package clog
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// EncoderFactory builds the encoder for a custom format.
+type EncoderFactory func(zapcore.EncoderConfig) zapcore.Encoder
+
+var (
+	customFormatsMu sync.RWMutex
+	customFormats   = map[logFormat]EncoderFactory{}
+)
+
+// RegisterFormat adds a custom format, which can then be used as the
+// Settings.Format.  Logs in that format get encoded by the encoder from the
+// factory, which receives zap's production encoder config, plus clog's time
+// and level encoding.  Registering an existing format replaces it, including
+// the built-in formats.
+func RegisterFormat(name logFormat, factory EncoderFactory) {
+	customFormatsMu.Lock()
+	defer customFormatsMu.Unlock()
+
+	_, registered := customFormats[name]
+	customFormats[name] = factory
+
+	if registered {
+		return
+	}
+
+	// the factory gets looked up at build time, so that replacing it
+	// doesn't need another zap registration.
+	err := zap.RegisterEncoder(customEncoding(name), func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		customFormatsMu.RLock()
+		defer customFormatsMu.RUnlock()
+
+		return customFormats[name](cfg), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// customEncoding produces the zap encoding name for the custom format.
+func customEncoding(name logFormat) string {
+	return "clog_format_" + string(name)
+}
+
+func isCustomFormat(name logFormat) bool {
+	customFormatsMu.RLock()
+	defer customFormatsMu.RUnlock()
+
+	_, ok := customFormats[name]
+
+	return ok
+}
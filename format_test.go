@@ -0,0 +1,66 @@
+package clog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zapcore"
+)
+
+type FormatUnitSuite struct {
+	suite.Suite
+}
+
+func TestFormatUnitSuite(t *testing.T) {
+	suite.Run(t, new(FormatUnitSuite))
+}
+
+func (suite *FormatUnitSuite) TestRegisterFormat() {
+	t := suite.T()
+
+	const custom logFormat = "test_custom_format"
+
+	RegisterFormat(custom, func(cfg zapcore.EncoderConfig) zapcore.Encoder {
+		cfg.MessageKey = "custom_msg"
+		return zapcore.NewJSONEncoder(cfg)
+	})
+
+	set := Settings{Format: custom}.EnsureDefaults()
+	assert.Equal(t, custom, set.Format, "registered formats are valid")
+
+	lines := logToFile(
+		t,
+		Settings{Format: custom},
+		func(ctx context.Context) {
+			Ctx(ctx).With("foo", "bar").Info("custom")
+		})
+	require.Len(t, lines, 1)
+
+	log := jsonLine(t, lines[0])
+	assert.Equal(t, "custom", log["custom_msg"])
+	assert.Equal(t, "bar", log["foo"])
+	assert.NotContains(t, log, "msg")
+
+	// replacing the format takes effect for new loggers.
+	RegisterFormat(custom, func(cfg zapcore.EncoderConfig) zapcore.Encoder {
+		cfg.MessageKey = "replaced_msg"
+		return zapcore.NewJSONEncoder(cfg)
+	})
+
+	lines = logToFile(
+		t,
+		Settings{Format: custom},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("replaced")
+		})
+	require.Len(t, lines, 1)
+	assert.Equal(t, "replaced", jsonLine(t, lines[0])["replaced_msg"])
+}
+
+func (suite *FormatUnitSuite) TestUnregisteredFormat() {
+	set := Settings{Format: "not_registered"}.EnsureDefaults()
+	assert.Equal(suite.T(), FormatForHumans, set.Format)
+}
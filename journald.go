@@ -0,0 +1,183 @@
+package clog
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// use for the systemd journal.  Each log gets encoded in the journal's
+// native protocol, so every field becomes a journal field that can be
+// queried with journalctl.  Normally used through JournaldSink.
+const FormatToJournald logFormat = "journald"
+
+// the socket where journald listens for native protocol logs.
+const defaultJournaldSocket = "/run/systemd/journal/socket"
+
+func init() {
+	RegisterFormat(FormatToJournald, func(cfg zapcore.EncoderConfig) zapcore.Encoder {
+		return newJournaldEncoder()
+	})
+}
+
+// JournaldSink produces a Sink that writes to the systemd journal through
+// the socket (defaults to journald's native protocol socket).  Levels map
+// to syslog priorities, and every field gets added as an uppercased journal
+// field, ex: "user_id" can be queried as `journalctl USER_ID=42`.
+//
+// Only linux has a journal.  Elsewhere, or if the socket can't be reached,
+// the sink drops its logs.
+func JournaldSink(socket string) Sink {
+	if len(socket) == 0 {
+		socket = defaultJournaldSocket
+	}
+
+	return Sink{
+		Writer: newJournaldWriter(socket),
+		Format: FormatToJournald,
+	}
+}
+
+// journaldPriority maps the zap level to its syslog priority.
+func journaldPriority(level zapcore.Level) int {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return 7 // debug
+	case level == zapcore.InfoLevel:
+		return 6 // info
+	case level == zapcore.WarnLevel:
+		return 4 // warning
+	case level == zapcore.ErrorLevel:
+		return 3 // err
+	default:
+		return 2 // crit
+	}
+}
+
+// journaldFieldName converts the key into a valid journal field name:
+// uppercase letters, digits, and underscores, not starting with an
+// underscore (those are reserved for journald) or a digit, and no longer
+// than 64 characters.  Returns "" if nothing is left of the key.
+func journaldFieldName(key string) string {
+	name := strings.Map(
+		func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z':
+				return r - 'a' + 'A'
+			case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+				return r
+			default:
+				return '_'
+			}
+		},
+		key)
+
+	name = strings.TrimLeft(name, "_0123456789")
+
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// journaldEncoder encodes each log as a single journal native protocol
+// message, ex:
+//
+//	PRIORITY=6
+//	MESSAGE=hello
+//	USER_ID=42
+type journaldEncoder struct {
+	// collects the fields added through With().
+	*zapcore.MapObjectEncoder
+}
+
+func newJournaldEncoder() *journaldEncoder {
+	return &journaldEncoder{zapcore.NewMapObjectEncoder()}
+}
+
+func (je *journaldEncoder) Clone() zapcore.Encoder {
+	clone := newJournaldEncoder()
+	maps.Copy(clone.Fields, je.Fields)
+
+	return clone
+}
+
+func (je *journaldEncoder) EncodeEntry(
+	ent zapcore.Entry,
+	fields []zapcore.Field,
+) (*buffer.Buffer, error) {
+	all := je.Fields
+
+	if len(fields) > 0 {
+		moe := zapcore.NewMapObjectEncoder()
+		maps.Copy(moe.Fields, je.Fields)
+
+		for _, f := range fields {
+			f.AddTo(moe)
+		}
+
+		all = moe.Fields
+	}
+
+	msg := bufPool.Get()
+
+	writeJournaldField(msg, "PRIORITY", strconv.Itoa(journaldPriority(ent.Level)))
+	writeJournaldField(msg, "MESSAGE", ent.Message)
+
+	if ent.Caller.Defined {
+		writeJournaldField(msg, "CODE_FILE", ent.Caller.File)
+		writeJournaldField(msg, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		writeJournaldField(msg, "CODE_FUNC", ent.Caller.Function)
+	}
+
+	if len(ent.Stack) > 0 {
+		writeJournaldField(msg, "STACKTRACE", ent.Stack)
+	}
+
+	all = flattenGroups(all)
+
+	keys := maps.Keys(all)
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		name := journaldFieldName(k)
+		if len(name) == 0 {
+			continue
+		}
+
+		v, ok := all[k].(string)
+		if !ok {
+			v = marshalValue(all[k])
+		}
+
+		writeJournaldField(msg, name, v)
+	}
+
+	return msg, nil
+}
+
+// writeJournaldField appends the field in the native protocol.  Values
+// containing newlines need the binary form: the name, a newline, the
+// value's length as a little-endian uint64, then the value.
+func writeJournaldField(msg *buffer.Buffer, name, value string) {
+	msg.AppendString(name)
+
+	if !strings.Contains(value, "\n") {
+		msg.AppendByte('=')
+		msg.AppendString(value)
+		msg.AppendByte('\n')
+
+		return
+	}
+
+	msg.AppendByte('\n')
+	_, _ = msg.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(value))))
+	msg.AppendString(value)
+	msg.AppendByte('\n')
+}
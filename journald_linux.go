@@ -0,0 +1,43 @@
+//go:build linux
+
+package clog
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/alcionai/clues"
+)
+
+// journaldWriter sends each write to journald as a single datagram.
+type journaldWriter struct {
+	socket string
+
+	dialOnce sync.Once
+	conn     *net.UnixConn
+}
+
+func newJournaldWriter(socket string) io.Writer {
+	return &journaldWriter{socket: socket}
+}
+
+func (jw *journaldWriter) Write(p []byte) (int, error) {
+	jw.dialOnce.Do(func() {
+		// no journal means no logs; the sink shouldn't break logging.
+		jw.conn, _ = net.DialUnix(
+			"unixgram",
+			nil,
+			&net.UnixAddr{Name: jw.socket, Net: "unixgram"})
+	})
+
+	if jw.conn == nil {
+		return len(p), nil
+	}
+
+	if _, err := jw.conn.Write(p); err != nil {
+		return 0, clues.Wrap(err, "writing to journald")
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package clog
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *JournaldUnitSuite) TestJournaldSink() {
+	t := suite.T()
+
+	// unix socket paths are limited in length, so t.TempDir may be too long.
+	dir, err := os.MkdirTemp("", "clog")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "journal.sock")
+
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+
+	defer journal.Close()
+
+	logToFile(
+		t,
+		Settings{
+			Format: FormatToJSON,
+			Sinks:  []Sink{JournaldSink(socket)},
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).With("user_id", 42).Error("to the journal")
+		})
+
+	buf := make([]byte, 64*1024)
+
+	n, err := journal.Read(buf)
+	require.NoError(t, err)
+
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "PRIORITY=3\nMESSAGE=to the journal\n"), msg)
+	assert.Contains(t, msg, "\nUSER_ID=42\n")
+	assert.Contains(t, msg, "\nCODE_FILE=")
+}
+
+func (suite *JournaldUnitSuite) TestJournaldSink_noJournal() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format: FormatToJSON,
+			Sinks:  []Sink{JournaldSink(filepath.Join(t.TempDir(), "missing.sock"))},
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("still logged")
+		})
+
+	require.Len(t, lines, 1, "other outputs are unaffected")
+	assert.Equal(t, "still logged", jsonLine(t, lines[0])["msg"])
+}
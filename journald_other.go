@@ -0,0 +1,10 @@
+//go:build !linux
+
+package clog
+
+import "io"
+
+// only linux has a journal, so the logs get dropped.
+func newJournaldWriter(string) io.Writer {
+	return io.Discard
+}
@@ -0,0 +1,86 @@
+package clog
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type JournaldUnitSuite struct {
+	suite.Suite
+}
+
+func TestJournaldUnitSuite(t *testing.T) {
+	suite.Run(t, new(JournaldUnitSuite))
+}
+
+func (suite *JournaldUnitSuite) TestJournaldPriority() {
+	table := []struct {
+		level  zapcore.Level
+		expect int
+	}{
+		{zapcore.DebugLevel, 7},
+		{zapcore.InfoLevel, 6},
+		{zapcore.WarnLevel, 4},
+		{zapcore.ErrorLevel, 3},
+		{zapcore.DPanicLevel, 2},
+		{zapcore.PanicLevel, 2},
+		{zapcore.FatalLevel, 2},
+	}
+	for _, test := range table {
+		suite.Run(test.level.String(), func() {
+			assert.Equal(suite.T(), test.expect, journaldPriority(test.level))
+		})
+	}
+}
+
+func (suite *JournaldUnitSuite) TestJournaldFieldName() {
+	table := []struct {
+		key    string
+		expect string
+	}{
+		{"user_id", "USER_ID"},
+		{"http.method", "HTTP_METHOD"},
+		{"clog-labels", "CLOG_LABELS"},
+		{"_reserved", "RESERVED"},
+		{"2fa", "FA"},
+		{"___", ""},
+		{"abcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcdefghij", "ABCDEFGHIJABCDEFGHIJABCDEFGHIJABCDEFGHIJABCDEFGHIJABCDEFGHIJABCD"},
+	}
+	for _, test := range table {
+		suite.Run(test.key, func() {
+			assert.Equal(suite.T(), test.expect, journaldFieldName(test.key))
+		})
+	}
+}
+
+func (suite *JournaldUnitSuite) TestJournaldEncoder() {
+	t := suite.T()
+
+	enc := newJournaldEncoder()
+	enc.AddString("user_id", "42")
+
+	buf, err := enc.EncodeEntry(
+		zapcore.Entry{Level: zapcore.ErrorLevel, Message: "disk on fire"},
+		[]zapcore.Field{
+			zap.Int("http.status", 500),
+			zap.String("detail", "line one\nline two"),
+		})
+	require.NoError(t, err)
+
+	multiline := "line one\nline two"
+	size := binary.LittleEndian.AppendUint64(nil, uint64(len(multiline)))
+
+	expect := "PRIORITY=3\n" +
+		"MESSAGE=disk on fire\n" +
+		"DETAIL\n" + string(size) + multiline + "\n" +
+		"HTTP_STATUS=500\n" +
+		"USER_ID=42\n"
+
+	assert.Equal(t, expect, buf.String())
+}
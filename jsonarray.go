@@ -0,0 +1,95 @@
+package clog
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// the zap sink scheme used for json array files.
+const jsonArrayScheme = "clogjsonarray"
+
+func init() {
+	err := zap.RegisterSink(jsonArrayScheme, func(u *url.URL) (zap.Sink, error) {
+		return newJSONArraySink(filePath(u))
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// the closing bracket of the array, which gets written on every sync.
+var arrayEnd = []byte("\n]")
+
+// jsonArraySink writes each json log as an element in a single json array.
+// The array gets closed on every sync, so that the file is well formed after
+// each Flush.  Writing again after a sync overwrites the closing bracket.
+type jsonArraySink struct {
+	mu      sync.Mutex
+	f       *os.File
+	started bool
+	closed  bool
+}
+
+func newJSONArraySink(path string) (*jsonArraySink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o666)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonArraySink{f: f}, nil
+}
+
+func (s *jsonArraySink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sep := []byte(",\n")
+
+	switch {
+	case !s.started:
+		sep = []byte("[\n")
+	case s.closed:
+		if _, err := s.f.Seek(-int64(len(arrayEnd)), io.SeekEnd); err != nil {
+			return 0, err
+		}
+	}
+
+	elem := append(sep, bytes.TrimRight(p, "\n")...)
+
+	if _, err := s.f.Write(elem); err != nil {
+		return 0, err
+	}
+
+	s.started = true
+	s.closed = false
+
+	return len(p), nil
+}
+
+func (s *jsonArraySink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started && !s.closed {
+		if _, err := s.f.Write(arrayEnd); err != nil {
+			return err
+		}
+
+		s.closed = true
+	}
+
+	return s.f.Sync()
+}
+
+func (s *jsonArraySink) Close() error {
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	return s.f.Close()
+}
@@ -0,0 +1,65 @@
+package clog
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type JSONArrayUnitSuite struct {
+	suite.Suite
+}
+
+func TestJSONArrayUnitSuite(t *testing.T) {
+	suite.Run(t, new(JSONArrayUnitSuite))
+}
+
+func (suite *JSONArrayUnitSuite) TestJSONArray() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{Format: FormatToJSONArray},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("one")
+			Ctx(ctx).Info("two")
+			Ctx(ctx).Info("three")
+		})
+
+	var logs []map[string]any
+
+	require.NoError(t, json.Unmarshal([]byte(strings.Join(lines, "\n")), &logs))
+	require.Len(t, logs, 3)
+	assert.Equal(t, "one", logs[0]["msg"])
+	assert.Equal(t, "two", logs[1]["msg"])
+	assert.Equal(t, "three", logs[2]["msg"])
+}
+
+func (suite *JSONArrayUnitSuite) TestJSONArray_writeAfterFlush() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{Format: FormatToJSONArray},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("one")
+			Flush(ctx)
+			Flush(ctx)
+			Ctx(ctx).Info("two")
+			Flush(ctx)
+			Ctx(ctx).Info("three")
+		})
+
+	var logs []map[string]any
+
+	require.NoError(t, json.Unmarshal([]byte(strings.Join(lines, "\n")), &logs))
+	require.Len(t, logs, 3)
+	assert.Equal(t, "one", logs[0]["msg"])
+	assert.Equal(t, "two", logs[1]["msg"])
+	assert.Equal(t, "three", logs[2]["msg"])
+}
@@ -2,13 +2,21 @@ package clog
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"testing"
 	"time"
 
 	"github.com/alcionai/clues"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // Yes, we just hijack zap for our logging needs here.
@@ -22,6 +30,84 @@ var (
 type clogger struct {
 	zsl *zap.SugaredLogger
 	set Settings
+	// nil unless the settings enable sampling.
+	smplr *sampler
+	// nil unless the settings enable async logging.
+	async *asyncQueue
+	// the number of logs delivered by the builder, for FlushWithSummary.
+	counts logCounts
+	// when the clogger was built, for Settings.ShowElapsed.
+	start time.Time
+
+	// the cores that write to the files added with builder.ToFile, keyed
+	// by path.  Built the first time each file gets used.
+	filesMu sync.Mutex
+	files   map[string]zapcore.Core
+}
+
+func newClogger(zsl *zap.SugaredLogger, set Settings) *clogger {
+	return &clogger{
+		zsl:   zsl,
+		set:   set,
+		smplr: newSampler(set.Sampling),
+		async: newAsyncQueue(set.AsyncQueueSize),
+		start: time.Now(),
+	}
+}
+
+// fileCore produces the core that writes to the file, using the clogger's
+// settings.  Cores are cached, so each file only gets opened once.
+func (clgr *clogger) fileCore(path string) (zapcore.Core, error) {
+	clgr.filesMu.Lock()
+	defer clgr.filesMu.Unlock()
+
+	if core, ok := clgr.files[path]; ok {
+		return core, nil
+	}
+
+	zlog, err := buildLogger(Sink{File: path}.settings(clgr.set))
+	if err != nil {
+		return nil, clues.Wrap(err, "building file logger").With("file", path)
+	}
+
+	if clgr.files == nil {
+		clgr.files = map[string]zapcore.Core{}
+	}
+
+	clgr.files[path] = zlog.Core()
+
+	return zlog.Core(), nil
+}
+
+// logCounts tallies the logs delivered at each level.  Warnings are logs
+// labeled with the Warning label, regardless of their level.
+type logCounts struct {
+	debug, info, error, warning atomic.Int64
+}
+
+func (lc *logCounts) add(l logLevel, labels []string) {
+	switch l {
+	case LevelDebug:
+		lc.debug.Add(1)
+	case LevelInfo:
+		lc.info.Add(1)
+	case LevelError:
+		lc.error.Add(1)
+	}
+
+	if _, ok := slices.BinarySearch(labels, Warning); ok {
+		lc.warning.Add(1)
+	}
+}
+
+// take returns the counts as summary fields, and resets them to zero.
+func (lc *logCounts) take() []any {
+	return []any{
+		"logs_debug", lc.debug.Swap(0),
+		"logs_info", lc.info.Swap(0),
+		"logs_error", lc.error.Swap(0),
+		"logs_warning", lc.warning.Swap(0),
+	}
 }
 
 // ---------------------------------------------------------------------------
@@ -29,95 +115,446 @@ type clogger struct {
 // ---------------------------------------------------------------------------
 
 func genLogger(set Settings) *zap.SugaredLogger {
-	// when testing, ensure debug logging matches the test.v setting
-	for _, arg := range os.Args {
-		if arg == `--test.v=true` {
-			set.Level = LevelDebug
-		}
+	// the builder adds two frames (ex: builder.Info -> builder.log)
+	// between the caller and the zap logger.
+	zlog, err := buildLogger(set, zap.AddCallerSkip(2+set.CallerSkip))
+	if err != nil {
+		var out string
+
+		zlog, out = zapcoreFallback(set)
+		zlog.Error("couldn't build the logger; logging to "+out+" instead", zap.Error(err))
+	}
+
+	// TODO: wrap the sugar logger to be a sugar... clogger...
+	return zlog.Sugar()
+}
+
+// every logger built by clog, as opposed to loggers planted by the caller,
+// so that FlushAll can sync them.  Keyed by the zsl that the caller holds,
+// so that Release can find it.  Loggers stay tracked until they're released
+// (or Reset, for the singleton).
+var (
+	builtLoggersMu sync.Mutex
+	builtLoggers   = map[*zap.SugaredLogger]*clogger{}
+)
+
+func trackLogger(zsl *zap.SugaredLogger, clgr *clogger) {
+	builtLoggersMu.Lock()
+	defer builtLoggersMu.Unlock()
+
+	builtLoggers[zsl] = clgr
+}
+
+// untrackLogger removes the logger from the registry, and returns the
+// clogger it was tracked with, if any.
+func untrackLogger(zsl *zap.SugaredLogger) (*clogger, bool) {
+	builtLoggersMu.Lock()
+	defer builtLoggersMu.Unlock()
+
+	clgr, ok := builtLoggers[zsl]
+	delete(builtLoggers, zsl)
+
+	return clgr, ok
+}
+
+// Release flushes the logger returned by New or InitWithWriter, and stops
+// tracking it for FlushAll.  Call it once you're done with a logger that
+// doesn't live as long as the process, ex: one built per request, else the
+// registry holds onto it forever.  The logger still works afterward, but
+// FlushAll no longer reaches it, and async loggers stop their background
+// writer and write synchronously instead.  Does nothing for loggers that
+// clog isn't tracking.
+func Release(zsl *zap.SugaredLogger) error {
+	clgr, ok := untrackLogger(zsl)
+	if !ok {
+		return nil
+	}
+
+	clgr.async.stop()
+
+	return ignoreBenignSyncErrs(clgr.zsl.Sync())
+}
+
+// New builds a standalone zap logger from the settings, without touching
+// the singleton.  Useful for handing a clog-configured logger to a package
+// that expects a zap logger.  Logs written to it skip the builder entirely,
+// so clues, labels, and other builder features don't apply.  Values hidden
+// with clues still get concealed, though: if the settings specify their
+// SensitiveInfoHandling, it gets applied process-wide, same as with Init.
+// Pass the logger to Release once you're done with it.
+func New(set Settings) (*zap.SugaredLogger, error) {
+	set = standaloneSettings(set)
+
+	zlog, err := buildLogger(set, zap.AddCallerSkip(set.CallerSkip))
+	if err != nil {
+		return nil, clues.Wrap(err, "building logger")
+	}
+
+	zsl := zlog.Sugar()
+	// the zsl bypasses the builder, so there's no async queue to run.
+	set.AsyncQueueSize = 0
+	trackLogger(zsl, newClogger(zsl, set))
+
+	return zsl, nil
+}
+
+// standaloneSettings fills in the defaults for a logger that lives outside
+// of the singleton.  Unlike Init, it doesn't claim the ResolvedLogFile, and
+// it only applies the pii handling if the caller set one, so that a side
+// logger with default settings can't undo the handling chosen by Init.
+func standaloneSettings(set Settings) Settings {
+	singleMu.Lock()
+	defer singleMu.Unlock()
+
+	if len(set.SensitiveInfoHandling) > 0 {
+		setCluesSecretsHash(set.SensitiveInfoHandling)
+	}
+
+	return set.withDefaults()
+}
+
+// buildLogger produces a zap logger from the settings, plus any additional
+// options.
+func buildLogger(set Settings, opts ...zap.Option) (*zap.Logger, error) {
+	if set.ForceDebugInTests && testing.Testing() {
+		set.Level = LevelDebug
+	}
+
+	if err := checkLogFile(set.File); err != nil {
+		return nil, err
 	}
 
 	var (
 		// this will be the backbone logger for the clogs
 		// TODO: would be nice to accept a variety of loggers here, and
 		// treat this all as a shim.  Oh well, gotta start somewhere.
-		zlog *zap.Logger
-		zcfg zap.Config
-		// by default only add stacktraces to panics, else it gets too noisy.
-		zopts = []zap.Option{
-			zap.AddStacktrace(zapcore.PanicLevel),
-			zap.AddCallerSkip(2),
-		}
+		zcfg  zap.Config
+		zopts = append(
+			[]zap.Option{
+				// wraps the core before anything else, so that the sinks
+				// (teed in below) keep their own levels.
+				zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+					return verbosityCore{core, set.Level}
+				}),
+				zap.AddStacktrace(stacktraceLevel(set)),
+			},
+			opts...)
 	)
 
-	switch set.Format {
+	zopts = append(zopts, set.ZapOptions...)
+
+	switch {
+	case isCustomFormat(set.Format):
+		zcfg = setLevel(zap.NewProductionConfig())
+		zcfg.Encoding = customEncoding(set.Format)
+		zcfg.EncoderConfig.EncodeTime = timeEncoder(set)
+		zcfg.EncoderConfig.EncodeLevel = namedLevelEncoder(
+			set,
+			zcfg.EncoderConfig.EncodeLevel,
+			false)
 	// JSON means each row should appear as a single json object.
-	case FormatToJSON:
-		zcfg = setLevel(zap.NewProductionConfig(), set.Level)
-		zcfg.OutputPaths = []string{set.File}
+	// JSON arrays wrap those rows into a single array.
+	case set.Format == FormatToJSON || set.Format == FormatToJSONArray:
+		zcfg = setLevel(zap.NewProductionConfig())
+		zcfg.EncoderConfig.EncodeTime = timeEncoder(set)
+		zcfg.EncoderConfig.EncodeLevel = namedLevelEncoder(
+			set,
+			zcfg.EncoderConfig.EncodeLevel,
+			false)
 		// by default we'll use the columnar non-json format, which uses tab
 		// separated values within each line, and may contain multiple json objs.
 	default:
-		zcfg = setLevel(zap.NewDevelopmentConfig(), set.Level)
+		zcfg = setLevel(zap.NewDevelopmentConfig())
+
+		enc, err := humanEncoding(humanOptions{
+			color:  useColor(set),
+			pretty: set.PrettyFields,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		zcfg.Encoding = enc
+		zcfg.EncoderConfig.EncodeTime = timeEncoder(set)
+
+		zcfg.EncoderConfig.EncodeLevel = levelEncoder(set)
+	}
 
-		zcfg.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.StampMilli)
+	zcfg.OutputPaths = []string{outputPath(set)}
+	zcfg.InitialFields = initialFields(set)
 
-		// when printing to stdout/stderr, colorize things!
-		if set.File == Stderr || set.File == Stdout {
-			zcfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if len(set.Sinks) == 0 {
+		return zcfg.Build(zopts...)
+	}
+
+	// each sink gets its own core, so that each one enforces its own level.
+	cores := make([]zapcore.Core, 0, len(set.Sinks))
+
+	for i, sink := range set.Sinks {
+		// disabled sinks stay in the settings, but never open their output.
+		if sink.Level == LevelDisabled {
+			continue
 		}
+
+		zlog, err := buildLogger(sink.settings(set))
+		if err != nil {
+			return nil, clues.Wrap(err, "building sink").With("sink_index", i)
+		}
+
+		cores = append(cores, zlog.Core())
 	}
 
-	zcfg.OutputPaths = []string{set.File}
+	zopts = append(zopts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(append([]zapcore.Core{core}, cores...)...)
+	}))
 
-	zlog, err := zcfg.Build(zopts...)
-	if err != nil {
-		zlog = zapcoreFallback(set)
+	return zcfg.Build(zopts...)
+}
+
+// checkLogFile catches log files that zap would fail to open with an
+// unhelpful error.
+func checkLogFile(file string) error {
+	if file == Stdout || file == Stderr || strings.Contains(file, "://") {
+		return nil
 	}
 
-	// TODO: wrap the sugar logger to be a sugar... clogger...
-	return zlog.Sugar()
+	fi, err := os.Stat(file)
+	if err == nil && fi.IsDir() {
+		return clues.New(fmt.Sprintf(
+			"log file %q is a directory; point the File at a file within it",
+			file))
+	}
+
+	return nil
+}
+
+// initialFields produces the fields that get baked into every log.
+func initialFields(set Settings) map[string]any {
+	fields := map[string]any{}
+
+	if set.IncludeHostPID {
+		// failure to resolve the hostname isn't worth failing the logger.
+		host, _ := os.Hostname()
+
+		fields["host"] = host
+		fields["pid"] = os.Getpid()
+	}
+
+	if set.IncludeBuildInfo {
+		bi := vcsInfo()
+
+		fields["vcs_revision"] = bi.revision
+		fields["vcs_time"] = bi.time
+	}
+
+	if len(set.SchemaVersion) > 0 {
+		fields["log_schema"] = set.SchemaVersion
+	}
+
+	return fields
+}
+
+type buildInfo struct {
+	revision string
+	time     string
+}
+
+// vcsInfo reads the vcs revision and commit time that the go toolchain
+// embedded in the binary.  Both are empty if the binary was built without
+// vcs info, ex: in tests.
+var vcsInfo = sync.OnceValue(func() buildInfo {
+	var bi buildInfo
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.revision = s.Value
+		case "vcs.time":
+			bi.time = s.Value
+		}
+	}
+
+	return bi
+})
+
+// stacktraceLevel produces the minimum level at which logs include a
+// stacktrace.  By default only add stacktraces to panics, else it gets
+// too noisy.
+func stacktraceLevel(set Settings) zapcore.LevelEnabler {
+	switch set.StacktraceAt {
+	case "":
+		return zapcore.PanicLevel
+	case LevelDisabled:
+		return zap.LevelEnablerFunc(func(zapcore.Level) bool { return false })
+	default:
+		return zapLevel(set.StacktraceAt)
+	}
+}
+
+// timeEncoder formats timestamps using the configured layout and timezone.
+// If no layout is configured, human logs default to time.StampMilli, and
+// json logs default to RFC3339.
+func timeEncoder(set Settings) zapcore.TimeEncoder {
+	layout := set.TimeFormat
+
+	if len(layout) == 0 {
+		layout = time.StampMilli
+
+		if set.Format == FormatToJSON || set.Format == FormatToJSONArray {
+			layout = time.RFC3339Nano
+		}
+	}
+
+	return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		if set.TimeUTC {
+			t = t.UTC()
+		}
+
+		enc.AppendString(t.Format(layout))
+	}
 }
 
 // set up a logger core to use as a fallback in case the config doesn't work.
 // we shouldn't ever need this, but it's nice to know there's a fallback in
 // case configuration gets buggery, because everyone still wants their logs.
-func zapcoreFallback(set Settings) *zap.Logger {
+// The fallback still writes to the configured file if it can, and to
+// stderr otherwise.  Returns the logger along with where it writes to.
+func zapcoreFallback(set Settings) (*zap.Logger, string) {
 	levelFilter := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		switch set.Level {
-		case LevelInfo:
-			return lvl >= zapcore.InfoLevel
-		case LevelError:
-			return lvl >= zapcore.ErrorLevel
-		case LevelDisabled:
-			return false
-		default:
-			// default to debug
-			return true
-		}
+		return set.Level != LevelDisabled && fromZapLevel(lvl).gte(set.Level)
 	})
 
 	// build out the zapcore fallback
 	var (
-		out            = zapcore.Lock(os.Stderr)
-		consoleEncoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+		out, name      = fallbackOutput(set.File)
+		consoleEncoder = newHumanEncoder(zap.NewDevelopmentEncoderConfig(), humanOptions{})
 		core           = zapcore.NewTee(zapcore.NewCore(consoleEncoder, out, levelFilter))
 	)
 
-	return zap.New(core)
+	return zap.New(core), name
+}
+
+// fallbackOutput opens the file for the fallback logger.  Anything that
+// isn't a plain file path, or that can't be opened, falls back to stderr.
+func fallbackOutput(file string) (zapcore.WriteSyncer, string) {
+	switch {
+	case file == Stdout:
+		return zapcore.Lock(os.Stdout), Stdout
+	case len(file) == 0, file == Stderr, strings.Contains(file, "://"):
+		return zapcore.Lock(os.Stderr), Stderr
+	}
+
+	f, err := openLogFile(file)
+	if err != nil {
+		return zapcore.Lock(os.Stderr), Stderr
+	}
+
+	return zapcore.Lock(f), file
+}
+
+// lets every level through the config.  The level filtering happens in the
+// verbosityCore instead, so that SetVerbosity can shift it.
+func setLevel(cfg zap.Config) zap.Config {
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	return cfg
+}
+
+// the number of steps that SetVerbosity shifts every level by.
+var verbosity atomic.Int64
+
+// SetVerbosity shifts the level of every clog-built logger by delta steps
+// along debug, info, error, and disabled.  Positive values are noisier,
+// negative values are quieter.  The shift is relative to each logger's
+// configured Settings.Level, not cumulative: SetVerbosity(0) restores the
+// configured levels.  Loggers (and sinks) configured as LevelDisabled stay
+// disabled, no matter the verbosity.  Applies to live loggers as well as any built later,
+// so it's safe to call before Init, such as when parsing a -v flag.
+func SetVerbosity(delta int) {
+	verbosity.Store(int64(delta))
+}
+
+// verbosityCore filters logs by the configured level, shifted by the
+// current verbosity.  The verbosity gets read on every check, so loggers
+// don't need to be tracked to pick up changes.
+type verbosityCore struct {
+	zapcore.Core
+	level logLevel
+}
+
+func (vc verbosityCore) Level() zapcore.Level {
+	delta := int(verbosity.Load())
+	if delta == 0 {
+		return zapLevel(vc.level)
+	}
+
+	return zapLevel(shiftLevel(vc.level, delta))
+}
+
+func (vc verbosityCore) Enabled(l zapcore.Level) bool {
+	return l >= vc.Level() && vc.Core.Enabled(l)
 }
 
-// converts a given logLevel into the zapcore level enum.
-func setLevel(cfg zap.Config, level logLevel) zap.Config {
+func (vc verbosityCore) With(fields []zapcore.Field) zapcore.Core {
+	return verbosityCore{vc.Core.With(fields), vc.level}
+}
+
+func (vc verbosityCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < vc.Level() {
+		return ce
+	}
+
+	return vc.Core.Check(ent, ce)
+}
+
+// shiftLevel moves the level delta steps towards debug, stopping at
+// either end of the level order.  Disabled is an off switch, not a step,
+// so it never shifts.
+func shiftLevel(level logLevel, delta int) logLevel {
+	if level == LevelDisabled {
+		return level
+	}
+
+	rank := level.rank() - delta
+	rank = max(levelOrder[LevelDebug], min(rank, levelOrder[LevelDisabled]))
+
+	for l, r := range levelOrder {
+		if r == rank {
+			return l
+		}
+	}
+
+	return level
+}
+
+// fromZapLevel maps the zapcore level to the closest logLevel.
+func fromZapLevel(level zapcore.Level) logLevel {
+	switch {
+	case level < zapcore.InfoLevel:
+		return LevelDebug
+	case level < zapcore.ErrorLevel:
+		return LevelInfo
+	default:
+		return LevelError
+	}
+}
+
+// zapLevel maps the logLevel to its zapcore equivalent.
+func zapLevel(level logLevel) zapcore.Level {
 	switch level {
-	case LevelInfo:
-		cfg.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	case LevelDebug:
+		return zapcore.DebugLevel
 	case LevelError:
-		cfg.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
+		return zapcore.ErrorLevel
 	case LevelDisabled:
-		cfg.Level = zap.NewAtomicLevelAt(zapcore.FatalLevel)
+		return zapcore.FatalLevel
+	default:
+		return zapcore.InfoLevel
 	}
-
-	return cfg
 }
 
 // singleton is the constructor and getter in one. Since we manage a global
@@ -135,14 +572,30 @@ func singleton(set Settings) *clogger {
 
 	zsl := genLogger(set)
 
-	cloggerton = &clogger{
-		zsl: zsl,
-		set: set,
-	}
+	cloggerton = newClogger(zsl, set)
+	trackLogger(zsl, cloggerton)
 
 	return cloggerton
 }
 
+// Reset flushes and discards the singleton, so that the next Init (or the
+// next log, if no logger is planted in the ctx) builds a new one.  Also
+// clears the ResolvedLogFile.  Contexts that already hold the prior logger
+// continue to use it, though async loggers write synchronously from then on.
+func Reset() {
+	singleMu.Lock()
+	defer singleMu.Unlock()
+
+	if cloggerton != nil {
+		cloggerton.async.stop()
+		_ = cloggerton.zsl.Sync()
+		_, _ = untrackLogger(cloggerton.zsl)
+	}
+
+	cloggerton = nil
+	ResolvedLogFile = ""
+}
+
 // ------------------------------------------------------------------------------------------------
 // context management
 // ------------------------------------------------------------------------------------------------
@@ -155,20 +608,137 @@ const ctxKey loggingKey = "clog_logger"
 // It is a preferred, but not necessary, initialization step.
 // If you don't call this and you start logging, or you call
 // Singleton(), then the package will initialize a logger instance
-// with the default values.  If you need to configure your logs,
-// make sure to embed this first.
+// with the default values, which still honor the CLOG_LEVEL,
+// CLOG_FORMAT, and CLOG_LOG_FILE env vars.  If you need to configure
+// your logs, make sure to embed this first.
+//
+// Only the first Init builds the singleton.  Calling Init again with
+// different settings logs a warning (or, if the first settings filter out
+// info logs, writes it to stderr), and the first settings win.  Use
+// Reset if you really need to replace the singleton.
 func Init(ctx context.Context, set Settings) context.Context {
 	clogged := singleton(set)
+
+	if !clogged.set.sameAs(set.EnsureDefaults()) {
+		warnConflictingInit(clogged, set)
+	}
+
 	clogged.zsl.Debugw("seeding logger", "logger_settings", set)
 
 	return plantLoggerInCtx(ctx, clogged)
 }
 
+// warnConflictingInit explains that the ignored settings didn't take.  The
+// warning goes out at the info level, so that it doesn't trip any alerting
+// on errors.  If the first Init's level would hide it (ex: when that level
+// is what the caller is trying to change), the warning goes straight to
+// stderr instead.
+func warnConflictingInit(clogged *clogger, ignored Settings) {
+	const msg = "clog was already initialized with different settings; the first Init wins. " +
+		"Call clog.Reset() before Init to replace the logger"
+
+	if !clogged.zsl.Desugar().Core().Enabled(zapcore.InfoLevel) {
+		fmt.Fprintf(os.Stderr, "clog: %s\n", msg)
+		return
+	}
+
+	clogged.zsl.
+		With("clog_labels", []string{Warning}).
+		Infow(
+			msg,
+			"logger_settings", clogged.set,
+			"ignored_settings", ignored)
+}
+
+// InitAndFlushOnDone is Init, plus FlushOnDone.  The returned func stops
+// watching the ctx, and must get called if the ctx may never be cancelled,
+// else the watcher will leak.
+func InitAndFlushOnDone(ctx context.Context, set Settings) (context.Context, func()) {
+	ctx = Init(ctx, set)
+	return ctx, FlushOnDone(ctx)
+}
+
+// FlushOnDone flushes the logger embedded in the ctx once the ctx is done.
+// Good for request-scoped loggers, where you'd rather not make every handler
+// remember to call Flush.  The returned func releases the watcher without
+// flushing, and must get called if the ctx may never be cancelled, else
+// the watcher will leak.
+func FlushOnDone(ctx context.Context) func() {
+	var (
+		stop = make(chan struct{})
+		once sync.Once
+	)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// both channels may be closed by the time we get scheduled,
+			// in which case stopping takes priority.
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			_ = Sync(ctx)
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
 // PlantLogger allows users to embed their own zap.SugaredLogger within the context.
 // It's good for inheriting a logger instance that was generated elsewhere, in case
 // you have a downstream package that wants to clog the code with a different zsl.
 func PlantLogger(ctx context.Context, seed *zap.SugaredLogger) context.Context {
-	return plantLoggerInCtx(ctx, &clogger{zsl: seed})
+	return plantLoggerInCtx(ctx, newClogger(seed, Settings{}))
+}
+
+// NewDiscardContext produces a context containing a logger that drops
+// everything.  Good for tests, or for libraries that want to guarantee
+// silence, since it never touches the global singleton.
+func NewDiscardContext() context.Context {
+	return plantLoggerInCtx(context.Background(), newClogger(zap.NewNop().Sugar(), Settings{}))
+}
+
+// InitForTest produces a context containing a debug level logger that writes
+// through tb.Log, so that logs get attributed to the test, interleave with
+// its output, and only show up if the test fails (or runs verbosely).  Never
+// touches the global singleton, so it's safe to call for every subtest.
+func InitForTest(tb testing.TB) context.Context {
+	zsl := zaptest.NewLogger(
+		tb,
+		zaptest.Level(zapcore.DebugLevel),
+		// the builder adds two frames between the caller and the zap logger.
+		zaptest.WrapOptions(zap.AddCaller(), zap.AddCallerSkip(2))).
+		Sugar()
+
+	return plantLoggerInCtx(context.Background(), newClogger(zsl, Settings{Level: LevelDebug}))
+}
+
+// PlantLoggerWith is PlantLogger, but the planted logger also carries the
+// provided settings, so that builders pulled from the ctx honor things like
+// the debug label filter and pii handling.  Settings get used as-is; the
+// zsl is already built, so file, format, and level are ignored.  So is the
+// AsyncQueueSize: nothing would ever stop the queue of a planted logger, so
+// planted loggers always write synchronously.
+func PlantLoggerWith(
+	ctx context.Context,
+	seed *zap.SugaredLogger,
+	set Settings,
+) context.Context {
+	if len(set.SensitiveInfoHandling) > 0 {
+		singleMu.Lock()
+		setCluesSecretsHash(set.SensitiveInfoHandling)
+		singleMu.Unlock()
+	}
+
+	set.AsyncQueueSize = 0
+
+	return plantLoggerInCtx(ctx, newClogger(seed, set))
 }
 
 // plantLoggerInCtx allows users to embed their own zap.SugaredLogger within the
@@ -184,20 +754,65 @@ func plantLoggerInCtx(
 	return context.WithValue(ctx, ctxKey, clogger)
 }
 
+// HasLogger reports whether a logger was planted in the ctx, ex: by Init or
+// PlantLogger.  Contexts without a planted logger still log, using the
+// singleton, but report false.  Good for libraries that want to plant
+// their own logger without clobbering one provided by the caller.
+func HasLogger(ctx context.Context) bool {
+	l, ok := ctx.Value(ctxKey).(*clogger)
+	return ok && l != nil
+}
+
+const labelsCtxKey loggingKey = "clog_labels"
+
+// WithLabels embeds the labels in the ctx, so that every builder made from
+// the ctx (or its children) starts out with those labels, ex:
+//
+//	ctx = clog.WithLabels(ctx, clog.StartOfRun)
+//	clog.Ctx(ctx).Info("starting up") // labeled with clog.StartOfRun
+//
+// Builders can still add more labels.  Labels embedded by a parent ctx
+// get kept alongside the new ones.
+func WithLabels(ctx context.Context, labels ...string) context.Context {
+	ls := ctxLabels(ctx)
+
+	for _, l := range labels {
+		ls = insertSorted(ls, l)
+	}
+
+	return context.WithValue(ctx, labelsCtxKey, ls)
+}
+
+// ctxLabels returns the labels embedded in the ctx.  The slice is shared,
+// which is safe, since labels are never modified in place.
+func ctxLabels(ctx context.Context) []string {
+	ls, _ := ctx.Value(labelsCtxKey).([]string)
+	return ls
+}
+
 // fromCtx pulls the clogger out of the context.  If no logger exists in the
-// ctx, it returns the global singleton.
+// ctx, it returns the global singleton.  The ctxKey value is always expected
+// to be a *clogger (see plantLoggerInCtx); anything else is treated as if no
+// logger was planted at all.
 func fromCtx(ctx context.Context) *clogger {
-	l := ctx.Value(ctxKey)
+	l, ok := ctx.Value(ctxKey).(*clogger)
 	// if l is still nil, we need to grab the global singleton or construct a singleton.
-	if l == nil {
-		l = singleton(Settings{}.EnsureDefaults())
+	if !ok || l == nil {
+		l = singleton(Settings{})
 	}
 
-	return l.(*clogger)
+	return l
 }
 
 // Ctx retrieves the logger embedded in the context.
 // It also extracts any clues from the ctx and adds all k:v pairs to that log instance.
+//
+// Both the logger and the clues get resolved from the ctx when the log is
+// delivered, not when Ctx is called.  A builder held onto for a while will
+// write to whatever logger the ctx resolves to at that time, ex: the new
+// singleton after a Reset and Init.  Contexts can't change the logger
+// planted in them, so a logger planted in a child ctx (ex: PlantLogger)
+// doesn't reach builders made from the parent.
 func Ctx(ctx context.Context) *builder {
 	return newBuilder(ctx)
 }
@@ -225,14 +840,72 @@ func Singleton() *builder {
 	}
 
 	return &builder{
-		ctx: context.Background(),
-		zsl: cloggerton.zsl,
+		ctx:  context.Background(),
+		clgr: cloggerton,
 	}
 }
 
-// Flush writes out all buffered logs.
+// Flush writes out all buffered logs in the logger embedded in the ctx,
+// or in the singleton if the ctx has no logger.  Any error from syncing
+// is dropped; use Sync if you want to know about them.
 // Probably good to do before shutting down whatever instance
 // had initialized the singleton.
 func Flush(ctx context.Context) {
-	_ = Ctx(ctx).zsl.Sync()
+	_ = Sync(ctx)
+}
+
+// FlushWithSummary logs a summary of the number of logs delivered at each
+// level since the logger was built (or since the last summary), then
+// flushes the logger.  Good for giving CLI users a final tally of errors
+// and warnings.  The counts reset after each summary.  The summary is an
+// info log, so it gets dropped if the logger's level is above info.
+func FlushWithSummary(ctx context.Context) {
+	clgr := fromCtx(ctx)
+	// the counts include queued logs, so they get written first.
+	clgr.async.drain()
+
+	// skipping back a frame, since we don't go through the builder.
+	clgr.zsl.
+		WithOptions(zap.AddCallerSkip(-1)).
+		Infow("clog summary", clgr.counts.take()...)
+
+	Flush(ctx)
+}
+
+// FlushAll writes out all buffered logs in every logger built by clog: the
+// singleton, and the loggers from InitWithWriter and New that haven't been
+// released (see Release).  Loggers planted
+// by the caller (ex: PlantLogger) belong to the caller, and aren't included.
+// The right call for shutting down an app with more than one logger.
+// Returns the errors from every logger that failed to sync, except for the
+// benign errors from syncing the console (see Sync).
+func FlushAll() error {
+	builtLoggersMu.Lock()
+	clgrs := maps.Values(builtLoggers)
+	builtLoggersMu.Unlock()
+
+	var errs []error
+
+	for _, clgr := range clgrs {
+		clgr.async.drain()
+
+		if err := ignoreBenignSyncErrs(clgr.zsl.Sync()); err != nil {
+			errs = append(errs, clues.Wrap(err, "syncing logger"))
+		}
+	}
+
+	return clues.Stack(errs...).OrNil()
+}
+
+// Sync writes out all buffered logs in the logger embedded in the ctx,
+// or in the singleton if the ctx has no logger.  Only that one logger
+// gets synced; other planted loggers need their own call.  Async loggers
+// write out everything in their queue first.  The errors that the console
+// returns when it can't be synced (ex: when stderr is a terminal) get
+// dropped, since they don't mean anything got lost.
+func Sync(ctx context.Context) error {
+	clgr := fromCtx(ctx)
+	clgr.async.drain()
+
+	return ignoreBenignSyncErrs(clgr.zsl.Sync())
 }
@@ -1,11 +1,24 @@
 package clog_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alcionai/clog"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type LoggerUnitSuite struct {
@@ -23,6 +36,7 @@ func (suite *LoggerUnitSuite) TestSettings_ensureDefaults() {
 	require.Empty(t, s.File, "file")
 	require.Empty(t, s.Level, "level")
 	require.Empty(t, s.Format, "format")
+	require.Empty(t, s.Color, "color")
 	require.Empty(t, s.SensitiveInfoHandling, "piialg")
 	require.Empty(t, s.OnlyLogDebugIfContainsLabel, "debug filter")
 
@@ -30,6 +44,728 @@ func (suite *LoggerUnitSuite) TestSettings_ensureDefaults() {
 	require.NotEmpty(t, s.File, "file")
 	require.NotEmpty(t, s.Level, "level")
 	require.NotEmpty(t, s.Format, "format")
+	require.NotEmpty(t, s.Color, "color")
 	require.NotEmpty(t, s.SensitiveInfoHandling, "piialg")
 	require.Empty(t, s.OnlyLogDebugIfContainsLabel, "debug filter")
 }
+
+func (suite *LoggerUnitSuite) TestSettings_ensureDefaults_env() {
+	table := []struct {
+		name   string
+		set    clog.Settings
+		level  string
+		format string
+		expect clog.Settings
+	}{
+		{
+			name:   "no env",
+			expect: clog.Settings{Level: clog.LevelInfo, Format: clog.FormatForHumans},
+		},
+		{
+			name:   "env values",
+			level:  "debug",
+			format: "json",
+			expect: clog.Settings{Level: clog.LevelDebug, Format: clog.FormatToJSON},
+		},
+		{
+			name:   "invalid env values",
+			level:  "loud",
+			format: "yaml",
+			expect: clog.Settings{Level: clog.LevelInfo, Format: clog.FormatForHumans},
+		},
+		{
+			name:   "settings override env",
+			set:    clog.Settings{Level: clog.LevelError, Format: clog.FormatForHumans},
+			level:  "debug",
+			format: "json",
+			expect: clog.Settings{Level: clog.LevelError, Format: clog.FormatForHumans},
+		},
+	}
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			t := suite.T()
+
+			t.Setenv("CLOG_LEVEL", test.level)
+			t.Setenv("CLOG_FORMAT", test.format)
+
+			s := test.set.EnsureDefaults()
+			assert.Equal(t, test.expect.Level, s.Level, "level")
+			assert.Equal(t, test.expect.Format, s.Format, "format")
+		})
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that's safe to read while
+// another goroutine writes to it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	return lb.buf.Write(p)
+}
+
+func (lb *lockedBuffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	return lb.buf.String()
+}
+
+// bufferedCtx plants a logger in the ctx that only writes to the returned
+// buffer when synced.
+func bufferedCtx(
+	t *testing.T,
+	ctx context.Context,
+) (context.Context, *lockedBuffer) {
+	lb := &lockedBuffer{}
+	ws := &zapcore.BufferedWriteSyncer{
+		WS:            zapcore.AddSync(lb),
+		Size:          1 << 20,
+		FlushInterval: time.Hour,
+	}
+
+	t.Cleanup(func() { _ = ws.Stop() })
+
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		ws,
+		zapcore.DebugLevel)
+
+	return clog.PlantLogger(ctx, zap.New(core).Sugar()), lb
+}
+
+func (suite *LoggerUnitSuite) TestFlushOnDone() {
+	t := suite.T()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, lb := bufferedCtx(t, ctx)
+
+	stop := clog.FlushOnDone(ctx)
+	defer stop()
+
+	clog.Ctx(ctx).Info("pending")
+	assert.Empty(t, lb.String(), "log should still be buffered")
+
+	cancel()
+
+	assert.Eventually(
+		t,
+		func() bool { return bytes.Contains([]byte(lb.String()), []byte("pending")) },
+		time.Second,
+		10*time.Millisecond,
+		"buffered log should get flushed")
+}
+
+func (suite *LoggerUnitSuite) TestFlushOnDone_stopped() {
+	t := suite.T()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, lb := bufferedCtx(t, ctx)
+
+	stop := clog.FlushOnDone(ctx)
+	stop()
+	// safe to call more than once
+	stop()
+
+	clog.Ctx(ctx).Info("pending")
+	cancel()
+
+	assert.Never(
+		t,
+		func() bool { return len(lb.String()) > 0 },
+		100*time.Millisecond,
+		10*time.Millisecond,
+		"stopped watcher should not flush")
+}
+
+func (suite *LoggerUnitSuite) TestInit_conflictingSettings() {
+	var (
+		t    = suite.T()
+		ctx  = context.Background()
+		file = filepath.Join(t.TempDir(), "clog.log")
+		// built fresh for each Init, like most callers would.
+		set = func() clog.Settings {
+			return clog.Settings{
+				File:       file,
+				Level:      clog.LevelInfo,
+				Format:     clog.FormatToJSON,
+				ZapOptions: []zap.Option{zap.AddStacktrace(zapcore.ErrorLevel)},
+			}
+		}
+		warning = "the first Init wins"
+	)
+
+	clog.Reset()
+	t.Cleanup(clog.Reset)
+
+	readLog := func() string {
+		clog.Flush(ctx)
+
+		bs, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		return string(bs)
+	}
+
+	ctx = clog.Init(ctx, set())
+	assert.NotContains(t, readLog(), warning, "first init")
+
+	ctx = clog.Init(ctx, set())
+	assert.NotContains(t, readLog(), warning, "identical settings")
+
+	diff := set()
+	diff.Level = clog.LevelError
+
+	ctx = clog.Init(ctx, diff)
+
+	lines := strings.Split(strings.TrimSpace(readLog()), "\n")
+	require.Len(t, lines, 1, "conflicting settings")
+	assert.Contains(t, lines[0], warning)
+	assert.Contains(t, lines[0], `"level":"info"`, "warnings aren't errors")
+}
+
+// captureStderr produces everything written to stderr while fn runs.
+func captureStderr(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stderr := os.Stderr
+	os.Stderr = w
+
+	defer func() { os.Stderr = stderr }()
+
+	fn()
+
+	require.NoError(t, w.Close())
+
+	bs, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(bs)
+}
+
+func (suite *LoggerUnitSuite) TestInit_conflictingSettings_quietFirstInit() {
+	quiet := []clog.Settings{
+		{Level: clog.LevelError},
+		{Level: clog.LevelDisabled},
+	}
+
+	for _, set := range quiet {
+		suite.Run(string(set.Level), func() {
+			var (
+				t    = suite.T()
+				ctx  = context.Background()
+				file = filepath.Join(t.TempDir(), "clog.log")
+			)
+
+			set.File = file
+			set.Format = clog.FormatToJSON
+
+			clog.Reset()
+			t.Cleanup(clog.Reset)
+
+			ctx = clog.Init(ctx, set)
+
+			louder := set
+			louder.Level = clog.LevelDebug
+
+			stderr := captureStderr(t, func() { ctx = clog.Init(ctx, louder) })
+			assert.Contains(t, stderr, "the first Init wins", "the first level doesn't hide the warning")
+
+			clog.Flush(ctx)
+
+			bs, err := os.ReadFile(file)
+			require.NoError(t, err)
+			assert.Empty(t, string(bs), "the warning isn't logged as an error")
+		})
+	}
+}
+
+// syncCounter is a zapcore.WriteSyncer that counts calls to Sync.
+type syncCounter struct {
+	syncs int
+	err   error
+}
+
+func (sc *syncCounter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (sc *syncCounter) Sync() error {
+	sc.syncs++
+	return sc.err
+}
+
+func syncCounterCtx(ctx context.Context, sc *syncCounter) context.Context {
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		sc,
+		zapcore.DebugLevel)
+
+	return clog.PlantLogger(ctx, zap.New(core).Sugar())
+}
+
+func (suite *LoggerUnitSuite) TestSync() {
+	var (
+		t      = suite.T()
+		first  = &syncCounter{}
+		second = &syncCounter{err: errors.New("sync failure")}
+		ctx1   = syncCounterCtx(context.Background(), first)
+		ctx2   = syncCounterCtx(context.Background(), second)
+	)
+
+	require.NoError(t, clog.Sync(ctx1))
+	assert.Equal(t, 1, first.syncs, "first logger synced")
+	assert.Equal(t, 0, second.syncs, "second logger untouched")
+
+	require.Error(t, clog.Sync(ctx2))
+	assert.Equal(t, 1, first.syncs, "first logger untouched")
+	assert.Equal(t, 1, second.syncs, "second logger synced")
+
+	// flush swallows the error
+	clog.Flush(ctx2)
+	assert.Equal(t, 2, second.syncs, "second logger flushed")
+}
+
+func (suite *LoggerUnitSuite) TestNew_fileIsDir() {
+	var (
+		t   = suite.T()
+		dir = t.TempDir()
+	)
+
+	_, err := clog.New(clog.Settings{File: dir})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), dir)
+	assert.Contains(t, err.Error(), "is a directory")
+
+	_, err = clog.New(clog.Settings{
+		File:  filepath.Join(dir, "clog.log"),
+		Sinks: []clog.Sink{{File: dir}},
+	})
+	require.Error(t, err, "sinks")
+	assert.Contains(t, err.Error(), "is a directory")
+}
+
+func (suite *LoggerUnitSuite) TestNew() {
+	var (
+		t    = suite.T()
+		file = filepath.Join(t.TempDir(), "standalone.log")
+	)
+
+	zsl, err := clog.New(clog.Settings{
+		File:   file,
+		Format: clog.FormatToJSON,
+		Level:  clog.LevelInfo,
+	})
+	require.NoError(t, err)
+
+	zsl.Infow("standalone", "foo", "bar")
+	require.NoError(t, zsl.Sync())
+
+	bs, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(bs), `"msg":"standalone"`)
+	assert.Contains(t, string(bs), `"foo":"bar"`)
+	assert.Contains(t, string(bs), "logger_test.go", "caller is the test, not a clog frame")
+}
+
+func (suite *LoggerUnitSuite) TestNew_buildFailure() {
+	var (
+		t   = suite.T()
+		dir = t.TempDir()
+	)
+
+	// a file within a file can't be opened.
+	blocker := filepath.Join(dir, "blocker")
+	require.NoError(t, os.WriteFile(blocker, []byte{}, 0o600))
+
+	zsl, err := clog.New(clog.Settings{
+		File:   filepath.Join(blocker, "clog.log"),
+		Format: clog.FormatToJSON,
+	})
+	assert.Error(t, err)
+	assert.Nil(t, zsl)
+}
+
+func (suite *LoggerUnitSuite) TestNew_piiHandling() {
+	t := suite.T()
+
+	defer clog.PlantLoggerWith(
+		context.Background(),
+		zap.NewNop().Sugar(),
+		clog.Settings{SensitiveInfoHandling: clog.ShowSensitiveInfoInPlainText})
+
+	zsl, err := clog.New(clog.Settings{
+		File:                  clog.Stderr,
+		SensitiveInfoHandling: clog.MaskSensitiveInfo,
+	})
+	require.NoError(t, err)
+
+	defer clog.Release(zsl)
+
+	assert.Equal(t, clog.MaskSensitiveInfo, clog.SensitiveInfoHandling(), "specified handling gets applied")
+
+	zsl, err = clog.New(clog.Settings{File: clog.Stderr})
+	require.NoError(t, err)
+
+	defer clog.Release(zsl)
+
+	assert.Equal(t, clog.MaskSensitiveInfo, clog.SensitiveInfoHandling(), "new without handling")
+
+	_, zsl = clog.InitWithWriter(context.Background(), clog.Settings{}, &bytes.Buffer{})
+
+	defer clog.Release(zsl)
+
+	assert.Equal(t, clog.MaskSensitiveInfo, clog.SensitiveInfoHandling(), "writer without handling")
+
+	_, zsl = clog.InitWithWriter(
+		context.Background(),
+		clog.Settings{SensitiveInfoHandling: clog.HashSensitiveInfo},
+		&bytes.Buffer{})
+
+	defer clog.Release(zsl)
+
+	assert.Equal(t, clog.HashSensitiveInfo, clog.SensitiveInfoHandling(), "writer with handling")
+}
+
+func (suite *LoggerUnitSuite) TestNew_concurrent() {
+	var (
+		t        = suite.T()
+		dir      = t.TempDir()
+		wg       sync.WaitGroup
+		resolved = clog.ResolvedLogFile
+	)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+
+			zsl, err := clog.New(clog.Settings{File: filepath.Join(dir, fmt.Sprintf("%d.log", i))})
+			if assert.NoError(t, err) {
+				_ = clog.Release(zsl)
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			_, zsl := clog.InitWithWriter(context.Background(), clog.Settings{}, &bytes.Buffer{})
+			_ = clog.Release(zsl)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, resolved, clog.ResolvedLogFile, "standalone loggers don't claim the resolved file")
+}
+
+func (suite *LoggerUnitSuite) TestPlantLoggerWith_concurrentPIIHandling() {
+	var (
+		t     = suite.T()
+		wg    sync.WaitGroup
+		modes = []clog.Settings{
+			{SensitiveInfoHandling: clog.HashSensitiveInfo},
+			{SensitiveInfoHandling: clog.MaskSensitiveInfo},
+		}
+		ctxs = make([]context.Context, len(modes))
+	)
+
+	defer clog.PlantLoggerWith(
+		context.Background(),
+		zap.NewNop().Sugar(),
+		clog.Settings{SensitiveInfoHandling: clog.ShowSensitiveInfoInPlainText})
+
+	for i, set := range modes {
+		wg.Add(1)
+
+		go func(i int, set clog.Settings) {
+			defer wg.Done()
+
+			ctxs[i] = clog.PlantLoggerWith(context.Background(), zap.NewNop().Sugar(), set)
+			clog.Ctx(ctxs[i]).Info("pii")
+		}(i, set)
+	}
+
+	wg.Wait()
+
+	assert.Contains(
+		t,
+		[]any{clog.HashSensitiveInfo, clog.MaskSensitiveInfo},
+		clog.SensitiveInfoHandling(),
+		"the last logger planted wins")
+}
+
+func (suite *LoggerUnitSuite) TestInitWithWriter() {
+	var (
+		t  = suite.T()
+		bb = &bytes.Buffer{}
+	)
+
+	ctx, zsl := clog.InitWithWriter(
+		context.Background(),
+		clog.Settings{
+			Format: clog.FormatToJSON,
+			Level:  clog.LevelInfo,
+		},
+		bb)
+
+	clog.Ctx(ctx).Debug("filtered")
+	clog.Ctx(ctx).With("foo", "bar").Info("to the writer")
+	zsl.Info("from the zsl")
+	clog.Flush(ctx)
+
+	lines := strings.Split(strings.TrimSpace(bb.String()), "\n")
+	require.Len(t, lines, 2)
+
+	assert.Contains(t, lines[0], `"msg":"to the writer"`)
+	assert.Contains(t, lines[0], `"foo":"bar"`)
+	assert.Contains(t, lines[0], "logger_test.go", "caller is the test, not a clog frame")
+	assert.Contains(t, lines[1], `"msg":"from the zsl"`)
+	assert.Contains(t, lines[1], "logger_test.go", "caller is the test, not a clog frame")
+}
+
+func (suite *LoggerUnitSuite) TestWithNewRequestID() {
+	var (
+		t       = suite.T()
+		ctx, lb = bufferedCtx(t, context.Background())
+	)
+
+	assert.Empty(t, clog.RequestID(ctx))
+
+	ctx = clog.WithNewRequestID(ctx)
+	id := clog.RequestID(ctx)
+	require.NotEmpty(t, id)
+
+	clog.Ctx(ctx).Info("one")
+	clog.Ctx(ctx).Info("two")
+
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	assert.Equal(t, id, clog.RequestID(child), "children inherit the id")
+
+	minted := clog.WithNewRequestID(child)
+	assert.NotEqual(t, id, clog.RequestID(minted), "children can mint their own id")
+
+	clog.Ctx(minted).Info("three")
+	clog.Flush(ctx)
+
+	lines := strings.Split(strings.TrimSpace(lb.String()), "\n")
+	require.Len(t, lines, 3)
+
+	assert.Contains(t, lines[0], `"request_id":"`+id+`"`)
+	assert.Contains(t, lines[1], `"request_id":"`+id+`"`)
+	assert.Contains(t, lines[2], `"request_id":"`+clog.RequestID(minted)+`"`)
+}
+
+func (suite *LoggerUnitSuite) TestImplicitSingleton_env() {
+	var (
+		t    = suite.T()
+		file = filepath.Join(t.TempDir(), "clog.log")
+	)
+
+	t.Setenv("CLOG_LEVEL", "debug")
+	t.Setenv("CLOG_FORMAT", "json")
+	t.Setenv("CLOG_LOG_FILE", file)
+
+	clog.Reset()
+	defer clog.Reset()
+
+	// no Init; the first log builds the singleton.
+	ctx := context.Background()
+
+	clog.Ctx(ctx).Debug("zero config")
+	clog.Flush(ctx)
+
+	bs, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), `"msg":"zero config"`)
+}
+
+func (suite *LoggerUnitSuite) TestReopenLogFile() {
+	var (
+		t       = suite.T()
+		dir     = t.TempDir()
+		file    = filepath.Join(dir, "clog.log")
+		rotated = filepath.Join(dir, "clog.log.1")
+	)
+
+	clog.Reset()
+	defer clog.Reset()
+
+	ctx := clog.Init(context.Background(), clog.Settings{
+		File:   file,
+		Format: clog.FormatToJSON,
+	})
+
+	clog.Ctx(ctx).Info("before rotation")
+	clog.Flush(ctx)
+
+	// logrotate moves the file out from under the logger.
+	require.NoError(t, os.Rename(file, rotated))
+
+	clog.Ctx(ctx).Info("still the old file")
+	require.NoError(t, clog.ReopenLogFile())
+
+	clog.Ctx(ctx).Info("after rotation")
+	clog.Flush(ctx)
+
+	bs, err := os.ReadFile(rotated)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "before rotation")
+	assert.Contains(t, string(bs), "still the old file")
+	assert.NotContains(t, string(bs), "after rotation")
+
+	bs, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "after rotation")
+	assert.NotContains(t, string(bs), "before rotation")
+}
+
+func (suite *LoggerUnitSuite) TestFlushWithSummary() {
+	var (
+		t       = suite.T()
+		ctx, lb = bufferedCtx(t, context.Background())
+	)
+
+	clog.Ctx(ctx).Debug("d")
+	clog.Ctx(ctx).Info("i1")
+	clog.Ctx(ctx).Label(clog.Warning).Info("i2")
+	clog.Ctx(ctx).Error("e1")
+	clog.Ctx(ctx).Error("e2")
+	clog.Ctx(ctx).Error("e3")
+
+	clog.FlushWithSummary(ctx)
+
+	lines := strings.Split(strings.TrimSpace(lb.String()), "\n")
+	require.Len(t, lines, 7)
+
+	summary := lines[6]
+	assert.Contains(t, summary, `"msg":"clog summary"`)
+	assert.Contains(t, summary, `"logs_debug":1`)
+	assert.Contains(t, summary, `"logs_info":2`)
+	assert.Contains(t, summary, `"logs_error":3`)
+	assert.Contains(t, summary, `"logs_warning":1`)
+
+	// the counts reset after each summary.
+	clog.FlushWithSummary(ctx)
+
+	lines = strings.Split(strings.TrimSpace(lb.String()), "\n")
+	require.Len(t, lines, 8)
+
+	summary = lines[7]
+	assert.Contains(t, summary, `"logs_info":0`)
+	assert.Contains(t, summary, `"logs_error":0`)
+}
+
+func (suite *LoggerUnitSuite) TestHasLogger() {
+	t := suite.T()
+
+	ctx := context.Background()
+	assert.False(t, clog.HasLogger(ctx), "bare ctx")
+
+	// logging from a bare ctx uses the singleton, but doesn't plant it.
+	clog.Ctx(ctx).Debug("singleton")
+	assert.False(t, clog.HasLogger(ctx), "bare ctx after logging")
+
+	assert.True(t, clog.HasLogger(clog.Init(ctx, clog.Settings{})), "init")
+	assert.True(t, clog.HasLogger(clog.PlantLogger(ctx, zap.NewNop().Sugar())), "planted")
+	assert.True(t, clog.HasLogger(clog.NewDiscardContext()), "discard")
+}
+
+// recordingTB captures the logs written to the test.
+type recordingTB struct {
+	testing.TB
+
+	mu   sync.Mutex
+	logs []string
+}
+
+func (r *recordingTB) Logf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (suite *LoggerUnitSuite) TestInitForTest() {
+	var (
+		t   = suite.T()
+		rec = &recordingTB{TB: t}
+		ctx = clog.InitForTest(rec)
+	)
+
+	clog.Ctx(ctx).With("k", "v").Debug("reaches the test")
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	require.Len(t, rec.logs, 1)
+	assert.Contains(t, rec.logs[0], "reaches the test")
+	assert.Contains(t, rec.logs[0], `"k": "v"`)
+	assert.Contains(t, rec.logs[0], "logger_test.go", "caller is the test")
+
+	// each subtest gets its own logger
+	t.Run("subtest", func(t *testing.T) {
+		sub := clog.InitForTest(t)
+		assert.True(t, clog.HasLogger(sub))
+		clog.Ctx(sub).Info("subtest log")
+	})
+}
+
+func (suite *LoggerUnitSuite) TestFlushAll() {
+	var (
+		t      = suite.T()
+		first  = &syncCounter{}
+		second = &syncCounter{}
+	)
+
+	ctx1, zsl1 := clog.InitWithWriter(context.Background(), clog.Settings{Format: clog.FormatToJSON}, first)
+	ctx2, zsl2 := clog.InitWithWriter(context.Background(), clog.Settings{Format: clog.FormatToJSON}, second)
+
+	defer clog.Release(zsl1)
+	defer clog.Release(zsl2)
+
+	clog.Ctx(ctx1).Info("first")
+	clog.Ctx(ctx2).Info("second")
+
+	// other loggers in the process may fail to sync, ex: to stderr.
+	_ = clog.FlushAll()
+
+	assert.Equal(t, 1, first.syncs, "first logger")
+	assert.Equal(t, 1, second.syncs, "second logger")
+}
+
+func (suite *LoggerUnitSuite) TestRelease() {
+	var (
+		t       = suite.T()
+		kept    = &syncCounter{}
+		dropped = &syncCounter{}
+	)
+
+	ctx1, zsl1 := clog.InitWithWriter(context.Background(), clog.Settings{Format: clog.FormatToJSON}, kept)
+	ctx2, zsl2 := clog.InitWithWriter(context.Background(), clog.Settings{Format: clog.FormatToJSON}, dropped)
+
+	defer clog.Release(zsl1)
+
+	clog.Ctx(ctx1).Info("kept")
+	clog.Ctx(ctx2).Info("released")
+
+	require.NoError(t, clog.Release(zsl2))
+	assert.Equal(t, 1, dropped.syncs, "release flushes the logger")
+
+	// other loggers in the process may fail to sync, ex: to stderr.
+	_ = clog.FlushAll()
+
+	assert.Equal(t, 1, kept.syncs, "tracked logger")
+	assert.Equal(t, 1, dropped.syncs, "released loggers aren't tracked")
+
+	require.NoError(t, clog.Release(zsl2), "releasing twice is a no-op")
+	assert.Equal(t, 1, dropped.syncs)
+}
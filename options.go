@@ -0,0 +1,67 @@
+package clog
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Option modifies the Settings used by InitWith.
+type Option func(*Settings)
+
+// InitWith is Init, but the settings get composed from options instead of
+// a fully populated Settings struct.  Anything not set by the options uses
+// the default settings.  Returns the ctx with the logger embedded, and the
+// underlying zap logger.
+//
+//	ctx, _ := clog.InitWith(
+//	  ctx,
+//	  clog.WithLevel(clog.LevelDebug),
+//	  clog.WithFormat(clog.FormatToJSON))
+func InitWith(ctx context.Context, opts ...Option) (context.Context, *zap.SugaredLogger) {
+	set := Settings{}
+
+	for _, opt := range opts {
+		opt(&set)
+	}
+
+	ctx = Init(ctx, set)
+
+	// the builder's caller skip doesn't apply to direct use of the zsl.
+	return ctx, fromCtx(ctx).zsl.WithOptions(zap.AddCallerSkip(-2))
+}
+
+// WithLevel sets the Settings.Level.
+func WithLevel(level logLevel) Option {
+	return func(set *Settings) {
+		set.Level = level
+	}
+}
+
+// WithFormat sets the Settings.Format.
+func WithFormat(format logFormat) Option {
+	return func(set *Settings) {
+		set.Format = format
+	}
+}
+
+// WithFile sets the Settings.File.
+func WithFile(file string) Option {
+	return func(set *Settings) {
+		set.File = file
+	}
+}
+
+// WithPII sets the Settings.SensitiveInfoHandling.
+func WithPII(alg sensitiveInfoHandlingAlgo) Option {
+	return func(set *Settings) {
+		set.SensitiveInfoHandling = alg
+	}
+}
+
+// WithDebugLabels sets the Settings.OnlyLogDebugIfContainsLabel.
+func WithDebugLabels(labels ...string) Option {
+	return func(set *Settings) {
+		set.OnlyLogDebugIfContainsLabel = labels
+	}
+}
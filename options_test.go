@@ -0,0 +1,57 @@
+package clog
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OptionsUnitSuite struct {
+	suite.Suite
+}
+
+func TestOptionsUnitSuite(t *testing.T) {
+	suite.Run(t, new(OptionsUnitSuite))
+}
+
+func (suite *OptionsUnitSuite) TestInitWith() {
+	var (
+		t    = suite.T()
+		file = filepath.Join(t.TempDir(), "clog.log")
+	)
+
+	Reset()
+	defer Reset()
+
+	prev := SensitiveInfoHandling()
+
+	defer func() {
+		singleMu.Lock()
+		setCluesSecretsHash(prev)
+		singleMu.Unlock()
+	}()
+
+	ctx, zsl := InitWith(
+		context.Background(),
+		WithLevel(LevelDebug),
+		WithFormat(FormatToJSON),
+		WithFile(file),
+		WithPII(MaskSensitiveInfo),
+		WithDebugLabels(APICall))
+	require.NotNil(t, zsl)
+
+	expect := Settings{
+		File:                        file,
+		Level:                       LevelDebug,
+		Format:                      FormatToJSON,
+		SensitiveInfoHandling:       MaskSensitiveInfo,
+		OnlyLogDebugIfContainsLabel: []string{APICall},
+	}.EnsureDefaults()
+
+	assert.True(t, fromCtx(ctx).set.sameAs(expect), "resolved settings")
+	assert.Equal(t, MaskSensitiveInfo, SensitiveInfoHandling())
+}
@@ -0,0 +1,44 @@
+package clog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/alcionai/clues"
+)
+
+// the key under which the request id appears in logs.
+const requestIDKey = "request_id"
+
+const requestIDCtxKey loggingKey = "clog_request_id"
+
+// WithNewRequestID mints a new, random request id and embeds it in the ctx.
+// Every log produced from the ctx, or any of its children, carries the id
+// as the "request_id" field.  Children can mint their own id to replace
+// the one they inherited.
+func WithNewRequestID(ctx context.Context) context.Context {
+	id := newRequestID()
+
+	ctx = context.WithValue(ctx, requestIDCtxKey, id)
+
+	return clues.Add(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id embedded in the ctx, or an empty
+// string if the ctx doesn't have one.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey).(string)
+	return id
+}
+
+// newRequestID produces a short, random, hex-encoded id.
+func newRequestID() string {
+	bs := make([]byte, 8)
+
+	// crypto/rand only fails if the os can't provide randomness,
+	// which isn't something a logger can fix.
+	_, _ = rand.Read(bs)
+
+	return hex.EncodeToString(bs)
+}
@@ -0,0 +1,150 @@
+package clog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alcionai/clues"
+)
+
+// Sampling thins out floods of repetitive logs.  Of the logs sharing the
+// same level and message, the first N get delivered, followed by every Mth
+// log after that.  Ex: First: 3, Thereafter: 10 delivers logs 1, 2, 3, 13,
+// 23, and so on.  The zero value disables sampling.
+type Sampling struct {
+	// the number of logs to deliver before sampling kicks in.
+	First int
+	// after the first N, deliver every Mth log.  If zero, every log after
+	// the first N gets dropped.
+	Thereafter int
+	// when populated, logs get counted separately for each value of this
+	// clues key in the ctx.  Ex: keying on a backup run's ID samples each
+	// run independently, so that a noisy run can't crowd out the logs of
+	// a quiet one.  Logs whose ctx doesn't contain the key share a single,
+	// global count.
+	ByCluesKey string
+	// how often the counts reset.  Defaults to one second, like zap's
+	// sampler.
+	Tick time.Duration
+}
+
+func (s Sampling) enabled() bool {
+	return s.First > 0 || s.Thereafter > 0
+}
+
+// sampleKey identifies the count that a log contributes to.
+type sampleKey struct {
+	// the value of the ByCluesKey, if the ctx contains it.
+	bucket    string
+	hasBucket bool
+	level     logLevel
+	msg       string
+}
+
+// the number of counters each sampler keeps.  Keys get hashed into one of
+// the counters, so memory stays fixed no matter how many distinct messages
+// or bucket values show up.  Keys that share a counter get sampled as one,
+// which is rare enough not to matter; zap's sampler makes the same trade.
+const sampleSlots = 4096
+
+// counters are shared between keys, so they need to reset every so often,
+// else a flood of distinct keys would leave every counter past the First.
+const defaultSampleTick = time.Second
+
+// sampler tracks the number of logs seen for each sampleKey.
+type sampler struct {
+	cfg Sampling
+
+	mu      sync.Mutex
+	counts  []int
+	resetAt time.Time
+}
+
+// newSampler produces a sampler for the config, or nil if sampling is
+// disabled.
+func newSampler(cfg Sampling) *sampler {
+	if !cfg.enabled() {
+		return nil
+	}
+
+	if cfg.Tick <= 0 {
+		cfg.Tick = defaultSampleTick
+	}
+
+	return &sampler{
+		cfg:    cfg,
+		counts: make([]int, sampleSlots),
+	}
+}
+
+// keep reports whether the log should get delivered.  Always true for
+// a nil sampler.
+func (s *sampler) keep(ctx context.Context, l logLevel, msg string) bool {
+	if s == nil {
+		return true
+	}
+
+	sk := sampleKey{level: l, msg: msg}
+
+	if len(s.cfg.ByCluesKey) > 0 {
+		if v, ok := clues.In(ctx).Map()[s.cfg.ByCluesKey]; ok {
+			sk.bucket = fmt.Sprint(v)
+			sk.hasBucket = true
+		}
+	}
+
+	slot := sk.hash() % sampleSlots
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); now.After(s.resetAt) {
+		clear(s.counts)
+		s.resetAt = now.Add(s.cfg.Tick)
+	}
+
+	s.counts[slot]++
+	n := s.counts[slot]
+
+	if n <= s.cfg.First {
+		return true
+	}
+
+	return s.cfg.Thereafter > 0 && (n-s.cfg.First)%s.cfg.Thereafter == 0
+}
+
+// hash produces the fnv-1a hash of the key, without allocating.
+func (sk sampleKey) hash() uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+
+	h := uint64(offset)
+
+	add := func(s string) {
+		for i := 0; i < len(s); i++ {
+			h ^= uint64(s[i])
+			h *= prime
+		}
+
+		// separates the fields, so that "ab"+"c" and "a"+"bc" differ.
+		h ^= 0xff
+		h *= prime
+	}
+
+	if sk.hasBucket {
+		add(sk.bucket)
+	} else {
+		// marks the missing bucket apart from an empty one.
+		h ^= 0xfe
+		h *= prime
+	}
+
+	add(string(sk.level))
+	add(sk.msg)
+
+	return h
+}
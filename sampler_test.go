@@ -0,0 +1,135 @@
+package clog
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alcionai/clues"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zapcore"
+)
+
+type SamplerUnitSuite struct {
+	suite.Suite
+}
+
+func TestSamplerUnitSuite(t *testing.T) {
+	suite.Run(t, new(SamplerUnitSuite))
+}
+
+func (suite *SamplerUnitSuite) TestSampling_byCluesKey() {
+	var (
+		t   = suite.T()
+		set = Settings{
+			Sampling: Sampling{
+				First:      2,
+				Thereafter: 3,
+				ByCluesKey: "backup_id",
+			},
+		}
+		ctx, logs = observedClogger(context.Background(), zapcore.DebugLevel, set)
+		opA       = clues.Add(ctx, "backup_id", "a")
+		opB       = clues.Add(ctx, "backup_id", "b")
+	)
+
+	// interleave the operations so that a shared count would
+	// produce a different set of delivered logs.
+	for i := 0; i < 8; i++ {
+		Ctx(opA).Info("progress")
+		Ctx(opB).Info("progress")
+	}
+
+	// each operation keeps logs 1, 2, 5, and 8.
+	perOp := map[any]int{}
+
+	for _, l := range logs.All() {
+		perOp[l.ContextMap()["backup_id"]]++
+	}
+
+	assert.Equal(t, map[any]int{"a": 4, "b": 4}, perOp)
+
+	// logs without the key fall back to the global count.
+	logs.TakeAll()
+
+	for i := 0; i < 8; i++ {
+		Ctx(ctx).Info("progress")
+	}
+
+	assert.Equal(t, 4, logs.Len())
+}
+
+func (suite *SamplerUnitSuite) TestSampling_separateMessagesAndLevels() {
+	var (
+		t   = suite.T()
+		set = Settings{
+			Sampling: Sampling{First: 1},
+		}
+		ctx, logs = observedClogger(context.Background(), zapcore.DebugLevel, set)
+	)
+
+	for i := 0; i < 3; i++ {
+		Ctx(ctx).Info("foo")
+		Ctx(ctx).Info("bar")
+		Ctx(ctx).Error("foo")
+	}
+
+	assert.Equal(t, 3, logs.Len(), "first of each message and level")
+}
+
+func (suite *SamplerUnitSuite) TestSampling_disabled() {
+	var (
+		t         = suite.T()
+		ctx, logs = observedClogger(context.Background(), zapcore.DebugLevel, Settings{})
+	)
+
+	for i := 0; i < 10; i++ {
+		Ctx(ctx).Info("foo")
+	}
+
+	assert.Equal(t, 10, logs.Len())
+}
+
+func (suite *SamplerUnitSuite) TestSampling_boundedCounts() {
+	var (
+		t   = suite.T()
+		smp = newSampler(Sampling{First: 1, ByCluesKey: "op_id"})
+		ctx = context.Background()
+	)
+
+	// one-off bucket values and messages each add a new key.
+	for i := 0; i < 50_000; i++ {
+		opCtx := clues.Add(ctx, "op_id", i)
+		smp.keep(opCtx, LevelInfo, fmt.Sprintf("handled item %d", i))
+	}
+
+	assert.Len(t, smp.counts, sampleSlots, "counts don't grow with distinct keys")
+
+	// the next tick resets the shared counters.
+	smp.resetAt = time.Now().Add(-time.Millisecond)
+
+	assert.True(t, smp.keep(ctx, LevelInfo, "repeated"), "first log")
+	assert.False(t, smp.keep(ctx, LevelInfo, "repeated"), "sampled out")
+}
+
+func (suite *SamplerUnitSuite) TestSampleKeyHash() {
+	t := suite.T()
+
+	assert.Equal(
+		t,
+		sampleKey{level: LevelInfo, msg: "m"}.hash(),
+		sampleKey{level: LevelInfo, msg: "m"}.hash(),
+		"stable")
+	assert.NotEqual(
+		t,
+		sampleKey{level: LevelInfo, msg: "m"}.hash(),
+		sampleKey{level: LevelInfo, msg: "m", hasBucket: true}.hash(),
+		"missing and empty buckets differ")
+	assert.NotEqual(
+		t,
+		sampleKey{bucket: "ab", hasBucket: true, level: LevelInfo, msg: "c"}.hash(),
+		sampleKey{bucket: "a", hasBucket: true, level: LevelInfo, msg: "bc"}.hash(),
+		"fields don't run together")
+}
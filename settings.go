@@ -1,20 +1,30 @@
 package clog
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
 	"time"
 
 	"golang.org/x/exp/slices"
 
 	"github.com/alcionai/clues"
+	"go.uber.org/zap"
 )
 
 // ---------------------------------------------------
 // consts
 // ---------------------------------------------------
 
-const clogLogFileEnv = "CLOG_LOG_FILE"
+const (
+	clogLogFileEnv = "CLOG_LOG_FILE"
+	clogLevelEnv   = "CLOG_LEVEL"
+	clogFormatEnv  = "CLOG_FORMAT"
+)
 
 type logLevel string
 
@@ -25,6 +35,47 @@ const (
 	LevelDisabled logLevel = "disabled"
 )
 
+// terminal levels end the program (or at least the goroutine) once the log
+// is written.  They're only produced by builder.Panic and builder.Fatal, and
+// can't be used as a logger's level.
+const (
+	levelPanic logLevel = "panic"
+	levelFatal logLevel = "fatal"
+)
+
+func (l logLevel) terminal() bool {
+	return l == levelPanic || l == levelFatal
+}
+
+// levelOrder ranks each level by severity, so that levels can be compared.
+// There's no trace or warn level; use labels for those instead.
+var levelOrder = map[logLevel]int{
+	LevelDebug:    0,
+	LevelInfo:     1,
+	LevelError:    2,
+	LevelDisabled: 3,
+}
+
+// valid reports whether the level is one of the known levels.
+func (l logLevel) valid() bool {
+	_, ok := levelOrder[l]
+	return ok
+}
+
+// gte reports whether l is at least as severe as the other level.
+// Unknown levels rank the same as info, the default level.
+func (l logLevel) gte(other logLevel) bool {
+	return l.rank() >= other.rank()
+}
+
+func (l logLevel) rank() int {
+	if r, ok := levelOrder[l]; ok {
+		return r
+	}
+
+	return levelOrder[LevelInfo]
+}
+
 type logFormat string
 
 const (
@@ -32,6 +83,10 @@ const (
 	FormatForHumans logFormat = "human"
 	// use for cloud logging
 	FormatToJSON logFormat = "json"
+	// use for tools that want a single well-formed json array instead
+	// of one object per line.  Only applies when logging to a file;
+	// stdout and stderr fall back to FormatToJSON.
+	FormatToJSONArray logFormat = "json_array"
 )
 
 type sensitiveInfoHandlingAlgo string
@@ -42,6 +97,18 @@ const (
 	ShowSensitiveInfoInPlainText sensitiveInfoHandlingAlgo = "plaintext"
 )
 
+type colorMode string
+
+const (
+	// colorize when writing to the console, unless the NO_COLOR or
+	// CLICOLOR_FORCE env conventions say otherwise.
+	ColorAuto colorMode = "auto"
+	// always colorize human-readable output.
+	ColorAlways colorMode = "always"
+	// never colorize human-readable output.
+	ColorNever colorMode = "never"
+)
+
 const (
 	Stderr = "stderr"
 	Stdout = "stdout"
@@ -52,7 +119,22 @@ const (
 // ---------------------------------------------------
 
 // Default location for writing log files.
-var defaultLogFileDir = filepath.Join(os.Getenv("HOME"), "Library", "Logs")
+var (
+	defaultLogFileDirMu sync.Mutex
+	defaultLogFileDir   = filepath.Join(os.Getenv("HOME"), "Library", "Logs")
+)
+
+// SetDefaultLogDir changes the directory used for the default log file,
+// which otherwise lives in ~/Library/Logs.  Logs still get written to a
+// timestamped file within a clog subdirectory.  Only applies to files that
+// haven't been resolved yet; call it at startup, before Init.  The File
+// setting and the CLOG_LOG_FILE env var both take precedence.
+func SetDefaultLogDir(dir string) {
+	defaultLogFileDirMu.Lock()
+	defer defaultLogFileDirMu.Unlock()
+
+	defaultLogFileDir = dir
+}
 
 // ResolvedLogFile is the first log file established by the caller.
 // It gets eagerly populated on the first act of ensuring settings
@@ -70,77 +152,338 @@ type Settings struct {
 	File   string    // what file to log to (alt: stderr, stdout)
 	Format logFormat // whether to format as text (console) or json (cloud)
 	Level  logLevel  // what level to log at
+	Color  colorMode // whether to colorize human-readable output
 
 	// more fiddly bits
-	SensitiveInfoHandling sensitiveInfoHandlingAlgo // how to obscure pii
+	// don't create the directory of the default log file if it's missing,
+	// ex: on read-only container filesystems.  If the default log file
+	// can't be written, logs go to stderr instead.  Only applies when the
+	// File isn't set.
+	NoCreateDir bool
+	// how to obscure pii.  Note that clues only has a single, process-wide
+	// hasher; whichever logger was most recently initialized with this
+	// setting determines the handling used by all loggers.
+	SensitiveInfoHandling sensitiveInfoHandlingAlgo
+	// keys whose values get logged in plain text, regardless of the
+	// SensitiveInfoHandling.  Ex: a tenant ID that's more useful to support
+	// than it is sensitive.  Only applies to values added to the builder
+	// (With, WithMap, etc); clues conceals the values in the ctx and in
+	// errors as soon as they're added, so there's no plain text left for
+	// the logger to recover.
+	PIIAllowKeys []string
+	// human-readable logs print map, slice, and struct values across
+	// multiple indented lines instead of packing them into a single line.
+	PrettyFields bool
+	// human-readable logs mark the level with a single capital letter (ex:
+	// "E" instead of "ERROR") for denser output.  LevelNames still apply.
+	ShortLevels bool
+	// prefix the keys of the ctx clues with "ctx.", and the keys of the
+	// error's clues with "err.", so that values from different sources
+	// can't collide, ex: a request "id" in the ctx and a file "id" in the
+	// error.  Values added to the builder don't get a prefix.
+	PrefixSources bool
+	// write each log's fields in alphabetical order by key, instead of in
+	// map order, so that the output is stable for snapshot tests.  Fields
+	// that clog attaches to every log (ex: vcs_revision) still come first.
+	SortKeys bool
+	// keys that get removed from every log, regardless of whether they
+	// came from the ctx clues, the error, or the builder.  Unlike pii
+	// handling, which conceals the value, the field is dropped entirely.
+	// Good for silencing huge fields injected by other libraries.
+	DropKeys []string
+	// the maximum number of fields that can get added to a single builder
+	// (through With, WithMap, Group, Tag, Commentf, etc).  Each member of a
+	// group counts as a field of its own.  Additional fields get dropped,
+	// and the log gets marked with "fields_truncated": true.  Guards against
+	// a long-lived builder growing without bounds.  Defaults to 1000.
+	MaxFieldsPerLog int
+	// add an "elapsed" field to every log, containing the time since the
+	// logger was built.
+	ShowElapsed bool
+	// the time.Format layout used for timestamps.  If empty, human logs
+	// use time.StampMilli, and json logs use RFC3339.
+	TimeFormat string
+	// record timestamps in UTC instead of the local timezone.
+	TimeUTC bool
+	// the number of additional stack frames to skip when reporting the
+	// log's caller.  Packages that wrap clog in their own helpers should
+	// set this to the number of wrapping layers; ie: 1 for a helper that
+	// calls clog directly.  Builder.SkipCaller gets added on top of this.
+	CallerSkip int
+	// add the "host" and "pid" of the current process to every log.
+	IncludeHostPID bool
+	// add the "vcs_revision" and "vcs_time" that the go toolchain embedded
+	// in the binary to every log.  Both are empty if the binary was built
+	// without vcs info.
+	IncludeBuildInfo bool
+	// add a "log_schema" field with this value to every log, so that
+	// downstream parsers can tell which version of your field conventions
+	// a log follows.  Omitted if empty.
+	SchemaVersion string
+	// the minimum level at which logs include a stacktrace.  If empty,
+	// only panics include stacktraces.  LevelDisabled turns them off.
+	StacktraceAt logLevel
 	// when non-empty, only debuglogs with a label that matches
 	// the provided labels will get delivered.  All other debug
 	// logs get dropped.  Good way to expose a little bit of debug
 	// logs without flooding your system.
 	OnlyLogDebugIfContainsLabel []string
+	// the minimum level for logs carrying the given label.  Ex: mapping
+	// APICall to LevelError drops all debug and info logs labeled with
+	// APICall.  If a log has multiple labels with thresholds, meeting any
+	// one of them is sufficient.  Unlabeled logs only use the Level, which
+	// also continues to apply to labeled logs.
+	LabelLevels map[string]logLevel
+	// log at the debug level, regardless of the Level, when running
+	// within a go test binary.
+	ForceDebugInTests bool
+	// replaces the name of the level in each log.  Ex: mapping LevelError
+	// to "CRITICAL" renders error logs with a level of CRITICAL, in both
+	// json and human-readable formats.  The "panic" and "fatal" levels can
+	// also get renamed.  Unmapped levels keep their default names.
+	LevelNames map[logLevel]string
+	// additional destinations for logs.  Every log gets written to the
+	// File, plus each of the sinks, so long as it meets the level of that
+	// destination.
+	Sinks []Sink
+	// nest the error's message, labels, and clues under a single "error"
+	// object, instead of merging the error's clues into the top level of
+	// the log alongside the ctx values.
+	NestErrors bool
+	// error (and panic and fatal) logs only include the error itself, and
+	// skip the clues from the ctx and the error, the "error_type", and the
+	// "error_labels".  Values added to the builder still get logged.  Good
+	// for clis, where a wall of clues would bury the error message.  Lower
+	// level logs keep the full context.
+	TerseErrors bool
+	// failed builder.Assert calls panic instead of only logging an error.
+	// Meant for development and tests; leave it off in production.
+	AssertPanics bool
+	// thins out floods of repetitive logs.  Disabled by default.
+	Sampling Sampling
+	// if positive, logs get built on the caller's goroutine, then queued
+	// up (with room for this many logs) to get written in the background,
+	// so that logging never blocks on i/o.  Logs get dropped while the
+	// queue is full; see DroppedLogs.  Flush and Sync wait for the queue
+	// to empty.  Panic and fatal logs always get written immediately.
+	// Disabled by default, and ignored by New and PlantLoggerWith.
+	AsyncQueueSize int
+
+	// OnLog, if populated, gets called once for every log that gets
+	// delivered (ie: after level, label, and sample filtering).  Good for
+	// counting logs by level to populate your metrics.
+	OnLog func(level logLevel, labels []string) `json:"-"`
+	// Enrich, if populated, gets called once for every log that gets
+	// delivered, with the merged set of fields from the ctx, the error, and
+	// the builder.  The returned fields are what get logged, so the hook can
+	// add, change, or remove fields, ex: to add a deployment region.  If the
+	// hook panics, the log is delivered without enrichment.
+	Enrich func(fields map[string]any) map[string]any `json:"-"`
+	// ExtraCtxFields, if populated, gets called once for every log that
+	// gets delivered, and the fields it returns get logged alongside the
+	// clues values in the ctx.  For context data that's stored without
+	// clues.  Clues values win if both have the same key.  Skipped along
+	// with the clues when TerseErrors applies.
+	ExtraCtxFields func(ctx context.Context) map[string]any `json:"-"`
+	// ZapOptions get applied to the underlying zap logger after clog's own
+	// options, ex: zap.Hooks or zap.WrapCore.  An escape hatch for power
+	// users; clog makes no promises about how these interact with its own
+	// behavior, and options that change the caller skip or the core can
+	// break clog features.
+	ZapOptions []zap.Option `json:"-"`
+}
+
+// Sink is an additional destination for logs.
+type Sink struct {
+	// the file to write to (alt: stderr, stdout).  Ignored if the Writer
+	// is populated.  Defaults to stderr.
+	File string
+	// the writer to write to.
+	Writer io.Writer `json:"-"`
+	// defaults to the Format of the Settings.
+	Format logFormat
+	// the minimum level of logs written to the sink, regardless of the
+	// Level of the Settings.  Defaults to the Level of the Settings.
+	// LevelDisabled silences the sink entirely, including panics and
+	// fatals, without needing to remove it from the settings.
+	Level logLevel
+}
+
+// settings produces the settings used to build the sink's logger, based on
+// the parent settings.
+func (s Sink) settings(parent Settings) Settings {
+	set := parent
+	set.Sinks = nil
+	// only the parent logger applies the options, else options that wrap
+	// the core would apply twice.
+	set.ZapOptions = nil
+	set.File = s.File
+
+	if s.Writer != nil {
+		set.File = writerPath(s.Writer)
+	}
+
+	if len(set.File) == 0 {
+		set.File = Stderr
+	}
+
+	if len(s.Format) > 0 {
+		set.Format = s.Format
+	}
+
+	if len(s.Level) > 0 {
+		set.Level = s.Level
+	}
+
+	return set
 }
 
 // EnsureDefaults sets any non-populated settings to their default value.
+// The level and format fall back to the CLOG_LEVEL and CLOG_FORMAT env
+// vars before using the hardcoded defaults.
 // exported for testing without circular dependencies.
 func (s Settings) EnsureDefaults() Settings {
+	set := s.withDefaults()
+
+	if len(ResolvedLogFile) == 0 {
+		ResolvedLogFile = set.File
+	}
+
+	return set
+}
+
+// withDefaults is EnsureDefaults, except that it leaves the ResolvedLogFile
+// alone.  Standalone loggers use it, so they don't claim the file.
+func (s Settings) withDefaults() Settings {
 	set := s
 
-	levels := []logLevel{LevelDisabled, LevelDebug, LevelInfo, LevelError}
-	if len(set.Level) == 0 || !slices.Contains(levels, set.Level) {
+	// explicit settings take precedence over the env.
+	if len(set.Level) == 0 {
+		set.Level = logLevel(os.Getenv(clogLevelEnv))
+	}
+
+	if !set.Level.valid() {
 		set.Level = LevelInfo
 	}
 
-	formats := []logFormat{FormatForHumans, FormatToJSON}
-	if len(set.Format) == 0 || !slices.Contains(formats, set.Format) {
+	if len(set.Format) == 0 {
+		set.Format = logFormat(os.Getenv(clogFormatEnv))
+	}
+
+	formats := []logFormat{FormatForHumans, FormatToJSON, FormatToJSONArray}
+	if !slices.Contains(formats, set.Format) && !isCustomFormat(set.Format) {
 		set.Format = FormatForHumans
 	}
 
+	colors := []colorMode{ColorAuto, ColorAlways, ColorNever}
+	if len(set.Color) == 0 || !slices.Contains(colors, set.Color) {
+		set.Color = ColorAuto
+	}
+
 	algs := []sensitiveInfoHandlingAlgo{ShowSensitiveInfoInPlainText, MaskSensitiveInfo, HashSensitiveInfo}
 	if len(set.SensitiveInfoHandling) == 0 || !slices.Contains(algs, set.SensitiveInfoHandling) {
 		set.SensitiveInfoHandling = ShowSensitiveInfoInPlainText
 	}
 
 	if len(set.File) == 0 {
-		set.File = GetLogFileOrDefault("")
+		set.File = resolveLogFile("", !set.NoCreateDir)
 	}
 
-	if len(ResolvedLogFile) == 0 {
-		ResolvedLogFile = set.File
+	return set
+}
+
+// sameAs reports whether both settings are equivalent.  Funcs can't be
+// compared directly, so func values (including those held in slices, like
+// the ZapOptions) only match if they share the same code pointer.
+func (s Settings) sameAs(other Settings) bool {
+	sv, ov := reflect.ValueOf(s), reflect.ValueOf(other)
+
+	for i := 0; i < sv.NumField(); i++ {
+		if !sameValue(sv.Field(i), ov.Field(i)) {
+			return false
+		}
 	}
 
-	return set
+	return true
+}
+
+// sameValue is reflect.DeepEqual, except that funcs get compared by their
+// code pointer.
+func sameValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Func:
+		return a.Pointer() == b.Pointer()
+
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+
+		if a.Elem().Type() != b.Elem().Type() {
+			return false
+		}
+
+		return sameValue(a.Elem(), b.Elem())
+
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+
+		for i := 0; i < a.Len(); i++ {
+			if !sameValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(a.Interface(), b.Interface())
 }
 
 // Returns the default location for log file storage.
 func defaultLogLocation() string {
+	defaultLogFileDirMu.Lock()
+	defer defaultLogFileDirMu.Unlock()
+
 	return filepath.Join(
 		defaultLogFileDir,
 		"clog",
 		time.Now().UTC().Format("2006-01-02T15-04-05Z")+".log")
 }
 
+// first returns the first non-empty string, or an empty string if all of
+// them are empty.
+func first(ss ...string) string {
+	for _, s := range ss {
+		if len(s) > 0 {
+			return s
+		}
+	}
+
+	return ""
+}
+
 // GetLogFileOrDefault finds the log file in the users local system.
 // Uses the env var declaration, if populated, else defaults to stderr.
 // If this has already been called once before, uses the result of that
 // prior call.
 func GetLogFileOrDefault(useThisFile string) string {
+	return resolveLogFile(useThisFile, true)
+}
+
+// resolveLogFile is GetLogFileOrDefault, where createDir decides whether
+// the log file's directory gets created if it's missing.  If not, and the
+// file can't be written, logs fall back to stderr.
+func resolveLogFile(useThisFile string, createDir bool) string {
 	if len(ResolvedLogFile) > 0 {
 		return ResolvedLogFile
 	}
 
-	// start by preferring the file given to us by the caller.
-	r := useThisFile
-
-	// if no file was provided, look for a configured location using
-	// the default ENV.
-	if len(r) == 0 {
-		r = os.Getenv(clogLogFileEnv)
-	}
-
-	// if no file was provided, fall back to the default file location.
-	if len(r) == 0 {
-		r = defaultLogLocation()
-	}
+	// prefer the file given to us by the caller, then the configured
+	// location from the ENV, and lastly the default file location.
+	r := first(useThisFile, os.Getenv(clogLogFileEnv), defaultLogLocation())
 
 	// direct to Stdout if provided '-'.
 	if r == "-" {
@@ -148,6 +491,19 @@ func GetLogFileOrDefault(useThisFile string) string {
 	}
 
 	// if outputting to a file, make sure we can access the file.
+	if r != Stdout && r != Stderr && !createDir {
+		if !writable(r) {
+			fmt.Fprintf(
+				os.Stderr,
+				"clog: can't write to log file %q, and NoCreateDir is set; logging to stderr instead\n",
+				r)
+
+			return Stderr
+		}
+
+		return r
+	}
+
 	if r != Stdout && r != Stderr {
 		logdir := filepath.Dir(r)
 
@@ -160,6 +516,47 @@ func GetLogFileOrDefault(useThisFile string) string {
 	return r
 }
 
+// writable reports whether the file can be opened for writing, creating
+// the file (but not its directory) if needed.
+func writable(file string) bool {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o666)
+	if err != nil {
+		return false
+	}
+
+	f.Close()
+
+	return true
+}
+
+// the pii handling most recently applied to clues.
+var activeSensitiveInfoHandling = ShowSensitiveInfoInPlainText
+
+// SensitiveInfoHandling returns the pii handling currently in effect.
+// Clues only has a single, process-wide hasher, so this is whatever was
+// applied most recently by Init or PlantLoggerWith, regardless of the
+// settings held by any individual logger.
+func SensitiveInfoHandling() sensitiveInfoHandlingAlgo {
+	singleMu.Lock()
+	defer singleMu.Unlock()
+
+	return activeSensitiveInfoHandling
+}
+
+// ObscureForTest returns the text clog would log for the value if it were
+// marked as sensitive (ex: with clues.Hide), under the pii handling that's
+// currently in effect.  Gives tests a deterministic expectation for
+// sensitive values without depending on the hasher's internals.
+func ObscureForTest(val any) string {
+	singleMu.Lock()
+	defer singleMu.Unlock()
+
+	return clues.Hide(val).Conceal()
+}
+
+// setCluesSecretsHash applies the algorithm to the clues hasher.  The hasher
+// is global to the process, so the most recent call wins for every logger.
+// Callers must hold the singleMu lock.
 func setCluesSecretsHash(alg sensitiveInfoHandlingAlgo) {
 	switch alg {
 	case HashSensitiveInfo:
@@ -168,5 +565,9 @@ func setCluesSecretsHash(alg sensitiveInfoHandlingAlgo) {
 		clues.SetHasher(clues.HashCfg{HashAlg: clues.Flatmask})
 	case ShowSensitiveInfoInPlainText:
 		clues.SetHasher(clues.NoHash())
+	default:
+		return
 	}
+
+	activeSensitiveInfoHandling = alg
 }
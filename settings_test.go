@@ -0,0 +1,1006 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alcionai/clues"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slices"
+)
+
+type SettingsUnitSuite struct {
+	suite.Suite
+}
+
+func TestSettingsUnitSuite(t *testing.T) {
+	suite.Run(t, new(SettingsUnitSuite))
+}
+
+// logToFile generates a logger from the settings that writes to a temp
+// file, and plants it in the ctx passed to fn.  Returns the lines written
+// to the file after fn completes.
+func logToFile(
+	t *testing.T,
+	set Settings,
+	fn func(ctx context.Context),
+) []string {
+	set.File = filepath.Join(t.TempDir(), "clog.log")
+
+	if len(set.Level) == 0 {
+		set.Level = LevelDebug
+	}
+
+	if len(set.Format) == 0 {
+		set.Format = FormatForHumans
+	}
+
+	ctx := plantLoggerInCtx(
+		context.Background(),
+		newClogger(genLogger(set), set))
+
+	fn(ctx)
+	Flush(ctx)
+
+	bs, err := os.ReadFile(set.File)
+	require.NoError(t, err)
+
+	return strings.Split(strings.TrimSpace(string(bs)), "\n")
+}
+
+// jsonLine unmarshals a single line of json-formatted log output.
+func jsonLine(t *testing.T, line string) map[string]any {
+	m := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(line), &m), line)
+
+	return m
+}
+
+func (suite *SettingsUnitSuite) TestTimeFormat() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:     FormatToJSON,
+			TimeFormat: time.RFC3339,
+			TimeUTC:    true,
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("what time is it")
+		})
+	require.Len(t, lines, 1)
+
+	ts, ok := jsonLine(t, lines[0])["ts"].(string)
+	require.True(t, ok, "timestamp is a string")
+	assert.True(t, strings.HasSuffix(ts, "Z"), "utc timestamp: %s", ts)
+
+	_, err := time.Parse(time.RFC3339, ts)
+	assert.NoError(t, err, "rfc3339 timestamp: %s", ts)
+}
+
+func (suite *SettingsUnitSuite) TestTimeFormat_defaults() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{Format: FormatToJSON},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("what time is it")
+		})
+	require.Len(t, lines, 1)
+
+	ts, ok := jsonLine(t, lines[0])["ts"].(string)
+	require.True(t, ok, "timestamp is a string")
+
+	_, err := time.Parse(time.RFC3339, ts)
+	assert.NoError(t, err, "json defaults to rfc3339: %s", ts)
+
+	lines = logToFile(
+		t,
+		Settings{Format: FormatForHumans},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("what time is it")
+		})
+	require.Len(t, lines, 1)
+
+	ts = strings.Split(lines[0], "\t")[0]
+
+	_, err = time.Parse(time.StampMilli, ts)
+	assert.NoError(t, err, "human defaults to StampMilli: %s", ts)
+}
+
+func (suite *SettingsUnitSuite) TestHumanFormat_sanitized() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{Format: FormatForHumans},
+		func(ctx context.Context) {
+			Ctx(ctx).
+				With("forged", "value\n\x1b[31mERROR\tfake row").
+				Info("message\n\x1b[31mERROR\tfake row")
+		})
+
+	require.Len(t, lines, 1, "a single row")
+	assert.NotContains(t, lines[0], "\x1b", "no terminal escapes")
+	assert.Contains(t, lines[0], `message\n\x1b[31mERROR\tfake row`, "escaped message")
+}
+
+func (suite *SettingsUnitSuite) TestStacktraceAt() {
+	table := []struct {
+		name        string
+		level       logLevel
+		expectInfo  bool
+		expectError bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:        "error",
+			level:       LevelError,
+			expectError: true,
+		},
+		{
+			name:        "info",
+			level:       LevelInfo,
+			expectInfo:  true,
+			expectError: true,
+		},
+		{
+			name:  "disabled",
+			level: LevelDisabled,
+		},
+	}
+
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			t := suite.T()
+
+			lines := logToFile(
+				t,
+				Settings{
+					Format:       FormatToJSON,
+					StacktraceAt: test.level,
+				},
+				func(ctx context.Context) {
+					Ctx(ctx).Info("info")
+					Ctx(ctx).Error("error")
+				})
+			require.Len(t, lines, 2)
+
+			assert.Equal(t, test.expectInfo, jsonLine(t, lines[0])["stacktrace"] != nil, "info stacktrace")
+			assert.Equal(t, test.expectError, jsonLine(t, lines[1])["stacktrace"] != nil, "error stacktrace")
+		})
+	}
+}
+
+// wrappedInfo stands in for a package that wraps clog in its own helpers.
+func wrappedInfo(ctx context.Context, msg string) {
+	Ctx(ctx).Info(msg)
+}
+
+func (suite *SettingsUnitSuite) TestCallerSkip() {
+	table := []struct {
+		name         string
+		skip         int
+		expectHelper bool
+	}{
+		{
+			name:         "no skip",
+			skip:         0,
+			expectHelper: true,
+		},
+		{
+			name:         "skip the helper",
+			skip:         1,
+			expectHelper: false,
+		},
+	}
+
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			var (
+				t          = suite.T()
+				callerLine int
+			)
+
+			lines := logToFile(
+				t,
+				Settings{
+					Format:     FormatToJSON,
+					CallerSkip: test.skip,
+				},
+				func(ctx context.Context) {
+					_, _, line, _ := runtime.Caller(0)
+					wrappedInfo(ctx, "wrapped")
+
+					callerLine = line + 1
+				})
+			require.Len(t, lines, 1)
+
+			caller, ok := jsonLine(t, lines[0])["caller"].(string)
+			require.True(t, ok, "caller is a string")
+
+			expect := fmt.Sprintf("settings_test.go:%d", callerLine)
+			assert.Equal(t, !test.expectHelper, strings.HasSuffix(caller, expect), caller)
+		})
+	}
+}
+
+func (suite *SettingsUnitSuite) TestLogLevel_gte() {
+	table := []struct {
+		level  logLevel
+		other  logLevel
+		expect bool
+	}{
+		{LevelDebug, LevelDebug, true},
+		{LevelDebug, LevelInfo, false},
+		{LevelDebug, LevelError, false},
+		{LevelDebug, LevelDisabled, false},
+		{LevelInfo, LevelDebug, true},
+		{LevelInfo, LevelInfo, true},
+		{LevelInfo, LevelError, false},
+		{LevelInfo, LevelDisabled, false},
+		{LevelError, LevelDebug, true},
+		{LevelError, LevelInfo, true},
+		{LevelError, LevelError, true},
+		{LevelError, LevelDisabled, false},
+		{LevelDisabled, LevelDebug, true},
+		{LevelDisabled, LevelInfo, true},
+		{LevelDisabled, LevelError, true},
+		{LevelDisabled, LevelDisabled, true},
+		// unknown levels rank as info
+		{"unknown", LevelInfo, true},
+		{"unknown", LevelError, false},
+		{LevelInfo, "unknown", true},
+		{LevelDebug, "unknown", false},
+	}
+
+	for _, test := range table {
+		name := fmt.Sprintf("%s gte %s", test.level, test.other)
+
+		suite.Run(name, func() {
+			assert.Equal(suite.T(), test.expect, test.level.gte(test.other))
+		})
+	}
+}
+
+func (suite *SettingsUnitSuite) TestFallbackLevelFilter() {
+	table := []struct {
+		level       logLevel
+		expectDebug bool
+		expectInfo  bool
+		expectError bool
+	}{
+		{LevelDebug, true, true, true},
+		{LevelInfo, false, true, true},
+		{LevelError, false, false, true},
+		{LevelDisabled, false, false, false},
+	}
+
+	for _, test := range table {
+		suite.Run(string(test.level), func() {
+			var (
+				t     = suite.T()
+				zl, _ = zapcoreFallback(Settings{Level: test.level})
+				core  = zl.Core()
+			)
+
+			assert.Equal(t, test.expectDebug, core.Enabled(zapcore.DebugLevel), "debug")
+			assert.Equal(t, test.expectInfo, core.Enabled(zapcore.InfoLevel), "info")
+			assert.Equal(t, test.expectError, core.Enabled(zapcore.ErrorLevel), "error")
+		})
+	}
+}
+
+func (suite *SettingsUnitSuite) TestFallbackHonorsFile() {
+	var (
+		t    = suite.T()
+		file = filepath.Join(t.TempDir(), "clog.log")
+		// a sink that points at a directory fails the build.
+		set = Settings{
+			File:   file,
+			Format: FormatToJSON,
+			Level:  LevelInfo,
+			Sinks:  []Sink{{File: t.TempDir()}},
+		}
+	)
+
+	zsl := genLogger(set)
+
+	zsl.Info("after the fallback")
+	require.NoError(t, zsl.Sync())
+
+	bs, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "couldn't build the logger; logging to "+file+" instead")
+	assert.Contains(t, lines[0], "is a directory", "explains why the build failed")
+	assert.Contains(t, lines[1], "after the fallback")
+}
+
+func (suite *SettingsUnitSuite) TestFallbackOutput() {
+	var (
+		t   = suite.T()
+		dir = t.TempDir()
+	)
+
+	table := []struct {
+		file   string
+		expect string
+	}{
+		{"", Stderr},
+		{Stderr, Stderr},
+		{Stdout, Stdout},
+		{"clogwriter://1", Stderr},
+		{dir, Stderr},
+		{filepath.Join(dir, "clog.log"), filepath.Join(dir, "clog.log")},
+	}
+	for _, test := range table {
+		suite.Run(test.file, func() {
+			_, name := fallbackOutput(test.file)
+			assert.Equal(suite.T(), test.expect, name)
+		})
+	}
+}
+
+func (suite *SettingsUnitSuite) TestIncludeHostPID() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:         FormatToJSON,
+			IncludeHostPID: true,
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("who am i")
+		})
+	require.Len(t, lines, 1)
+
+	host, err := os.Hostname()
+	require.NoError(t, err)
+
+	log := jsonLine(t, lines[0])
+	assert.Equal(t, host, log["host"])
+	assert.Equal(t, float64(os.Getpid()), log["pid"])
+
+	lines = logToFile(
+		t,
+		Settings{Format: FormatToJSON},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("who am i")
+		})
+	require.Len(t, lines, 1)
+
+	log = jsonLine(t, lines[0])
+	assert.NotContains(t, log, "host")
+	assert.NotContains(t, log, "pid")
+}
+
+func (suite *SettingsUnitSuite) TestSchemaVersion() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:        FormatToJSON,
+			SchemaVersion: "2",
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("versioned")
+			Ctx(ctx).Error("also versioned")
+		})
+	require.Len(t, lines, 2)
+
+	for _, line := range lines {
+		assert.Equal(t, "2", jsonLine(t, line)["log_schema"])
+	}
+
+	lines = logToFile(
+		t,
+		Settings{Format: FormatToJSON},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("unversioned")
+		})
+	require.Len(t, lines, 1)
+	assert.NotContains(t, jsonLine(t, lines[0]), "log_schema")
+}
+
+func (suite *SettingsUnitSuite) TestIncludeBuildInfo() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:           FormatToJSON,
+			IncludeBuildInfo: true,
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("which build")
+		})
+	require.Len(t, lines, 1)
+
+	// test binaries don't embed vcs info, so the values may be empty.
+	log := jsonLine(t, lines[0])
+	assert.Contains(t, log, "vcs_revision")
+	assert.Contains(t, log, "vcs_time")
+
+	lines = logToFile(
+		t,
+		Settings{Format: FormatToJSON},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("which build")
+		})
+	require.Len(t, lines, 1)
+
+	log = jsonLine(t, lines[0])
+	assert.NotContains(t, log, "vcs_revision")
+	assert.NotContains(t, log, "vcs_time")
+}
+
+func (suite *SettingsUnitSuite) TestPrettyFields() {
+	t := suite.T()
+
+	logNested := func(ctx context.Context) {
+		Ctx(ctx).
+			With(
+				"nested", map[string]any{"inner": "val", "list": []int{1, 2}},
+				"scalar", "plain").
+			Info("pretty")
+	}
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:       FormatForHumans,
+			PrettyFields: true,
+		},
+		logNested)
+	require.Greater(t, len(lines), 1, "complex fields span multiple lines")
+
+	var foundInner bool
+
+	for _, l := range lines[1:] {
+		if strings.Contains(l, `"inner": "val"`) {
+			foundInner = true
+
+			assert.True(t, strings.HasPrefix(l, "    "), "indented: %q", l)
+		}
+	}
+
+	assert.True(t, foundInner, "nested key on its own line")
+	assert.Contains(t, strings.Join(lines, "\n"), `"scalar": "plain"`)
+
+	lines = logToFile(
+		t,
+		Settings{Format: FormatForHumans},
+		logNested)
+	require.Len(t, lines, 1, "fields stay on one line by default")
+}
+
+func (suite *SettingsUnitSuite) TestNestErrors() {
+	t := suite.T()
+
+	logErr := func(ctx context.Context) {
+		ctx = clues.Add(ctx, "req_id", "r1")
+		err := clues.New("broken").
+			With("file", "f.txt").
+			Label("io")
+
+		CtxErr(ctx, err).Error("failed")
+	}
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:     FormatToJSON,
+			NestErrors: true,
+		},
+		logErr)
+	require.Len(t, lines, 1)
+
+	log := jsonLine(t, lines[0])
+	assert.Equal(t, "r1", log["req_id"], "ctx values stay at the top level")
+	assert.NotContains(t, log, "file", "error values don't leak to the top level")
+	assert.NotContains(t, log, "error_labels")
+
+	errObj, ok := log["error"].(map[string]any)
+	require.True(t, ok, "error is an object")
+	assert.Equal(t, "broken", errObj["msg"])
+	assert.Equal(t, "*clues.Err", errObj["type"])
+	assert.Contains(t, errObj["labels"], "io")
+
+	errClues, ok := errObj["clues"].(map[string]any)
+	require.True(t, ok, "error clues are an object")
+	assert.Equal(t, "f.txt", errClues["file"])
+
+	lines = logToFile(
+		t,
+		Settings{Format: FormatToJSON},
+		logErr)
+	require.Len(t, lines, 1)
+
+	log = jsonLine(t, lines[0])
+	assert.Equal(t, "broken", log["error"])
+	assert.Equal(t, "f.txt", log["file"])
+	assert.Contains(t, log["error_labels"], "io")
+}
+
+func (suite *SettingsUnitSuite) TestTerseErrors() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format:      FormatToJSON,
+			TerseErrors: true,
+			NestErrors:  true,
+		},
+		func(ctx context.Context) {
+			ctx = clues.Add(ctx, "req_id", "r1")
+			err := clues.New("broken").
+				With("file", "f.txt").
+				Label("io")
+
+			CtxErr(ctx, err).With("k", "v").Error("failed")
+			CtxErr(ctx, err).Debug("full context")
+		})
+	require.Len(t, lines, 2)
+
+	log := jsonLine(t, lines[0])
+	assert.Equal(t, "broken", log["error"], "just the error message")
+	assert.Equal(t, "v", log["k"], "builder values are kept")
+	assert.NotContains(t, log, "req_id")
+	assert.NotContains(t, log, "file")
+	assert.NotContains(t, log, "error_type")
+	assert.NotContains(t, log, "error_labels")
+
+	log = jsonLine(t, lines[1])
+	assert.Equal(t, "r1", log["req_id"], "lower levels keep the ctx")
+
+	errObj, ok := log["error"].(map[string]any)
+	require.True(t, ok, "lower levels keep the error details")
+	assert.Equal(t, "broken", errObj["msg"])
+}
+
+func (suite *SettingsUnitSuite) TestForceDebugInTests() {
+	t := suite.T()
+
+	// an arg that used to silently force debug logging.
+	args := os.Args
+	os.Args = append(slices.Clone(os.Args), "--test.v=true")
+
+	defer func() { os.Args = args }()
+
+	zsl, err := New(Settings{File: Stderr, Level: LevelInfo})
+	require.NoError(t, err)
+	assert.False(t, zsl.Desugar().Core().Enabled(zapcore.DebugLevel), "args don't override the level")
+
+	zsl, err = New(Settings{File: Stderr, Level: LevelInfo, ForceDebugInTests: true})
+	require.NoError(t, err)
+	assert.True(t, zsl.Desugar().Core().Enabled(zapcore.DebugLevel), "forced debug within tests")
+}
+
+func (suite *SettingsUnitSuite) TestZapOptions() {
+	var (
+		t    = suite.T()
+		msgs []string
+	)
+
+	hook := zap.Hooks(func(ent zapcore.Entry) error {
+		msgs = append(msgs, ent.Message)
+		return nil
+	})
+
+	lines := logToFile(
+		t,
+		Settings{
+			ZapOptions: []zap.Option{hook},
+			Sinks:      []Sink{{Writer: &bytes.Buffer{}}},
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Info("hooked")
+		})
+	require.Len(t, lines, 1)
+
+	assert.Equal(t, []string{"hooked"}, msgs, "the hook fires once, regardless of the sinks")
+}
+
+func (suite *SettingsUnitSuite) TestSinks_levels() {
+	var (
+		t         = suite.T()
+		debugSink = &bytes.Buffer{}
+		infoSink  = &bytes.Buffer{}
+		errSink   = &bytes.Buffer{}
+	)
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format: FormatToJSON,
+			Level:  LevelInfo,
+			Sinks: []Sink{
+				{Writer: debugSink, Level: LevelDebug},
+				{Writer: infoSink, Level: LevelInfo},
+				{Writer: errSink, Level: LevelError, Format: FormatForHumans},
+			},
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Debug("debug")
+			Ctx(ctx).Info("info")
+			Ctx(ctx).Error("error")
+		})
+
+	msgs := func(lines []string) []string {
+		var ms []string
+
+		for _, l := range lines {
+			ms = append(ms, jsonLine(t, l)["msg"].(string))
+		}
+
+		return ms
+	}
+
+	sinkLines := func(bb *bytes.Buffer) []string {
+		return strings.Split(strings.TrimSpace(bb.String()), "\n")
+	}
+
+	assert.Equal(t, []string{"info", "error"}, msgs(lines), "file")
+	assert.Equal(t, []string{"debug", "info", "error"}, msgs(sinkLines(debugSink)), "debug sink")
+	assert.Equal(t, []string{"info", "error"}, msgs(sinkLines(infoSink)), "info sink")
+
+	errLines := sinkLines(errSink)
+	require.Len(t, errLines, 1, "error sink")
+	assert.Contains(t, errLines[0], "ERROR\t")
+	assert.Contains(t, errLines[0], "\terror")
+}
+
+func (suite *SettingsUnitSuite) TestSinks_disabled() {
+	var (
+		t        = suite.T()
+		disabled = &bytes.Buffer{}
+		enabled  = &bytes.Buffer{}
+	)
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format: FormatToJSON,
+			Sinks: []Sink{
+				{Writer: disabled, Level: LevelDisabled},
+				{Writer: enabled, Level: LevelDebug},
+			},
+		},
+		func(ctx context.Context) {
+			Ctx(ctx).Debug("debug")
+			Ctx(ctx).Error("error")
+		})
+
+	assert.Len(t, lines, 2, "file")
+	assert.Empty(t, disabled.String(), "disabled sink")
+	assert.Equal(t, 2, strings.Count(enabled.String(), "\n"), "enabled sink")
+}
+
+func (suite *SettingsUnitSuite) TestSinks_formatParity() {
+	var (
+		t        = suite.T()
+		jsonFile = filepath.Join(t.TempDir(), "clog.json")
+	)
+
+	lines := logToFile(
+		t,
+		Settings{
+			Format: FormatForHumans,
+			Sinks:  []Sink{{File: jsonFile, Format: FormatToJSON}},
+		},
+		func(ctx context.Context) {
+			ctx = clues.Add(ctx, "from_ctx", "clues")
+
+			Ctx(ctx).
+				Label("migration").
+				Comment("parity").
+				With("from_with", 1).
+				Group("http", "method", "GET").
+				Info("both formats")
+		})
+	require.Len(t, lines, 1)
+
+	bs, err := os.ReadFile(jsonFile)
+	require.NoError(t, err)
+
+	// the human line ends with the fields as an object.
+	i := strings.Index(lines[0], "\t{")
+	require.Positive(t, i, lines[0])
+
+	human := jsonLine(t, lines[0][i+1:])
+	structured := jsonLine(t, strings.TrimSpace(string(bs)))
+
+	assert.Equal(t, "both formats", structured["msg"])
+	assert.Contains(t, lines[0], "\tboth formats\t")
+
+	for _, k := range []string{"msg", "level", "ts", "caller"} {
+		delete(structured, k)
+	}
+
+	// human logs render groups as dotted keys.
+	http, ok := structured["http"].(map[string]any)
+	require.True(t, ok, "json keeps the group")
+	delete(structured, "http")
+	structured["http.method"] = http["method"]
+
+	assert.Equal(t, structured, human)
+	assert.Equal(t, []any{"migration"}, human["clog_labels"])
+	assert.Equal(t, "clues", human["from_ctx"])
+}
+
+func (suite *SettingsUnitSuite) TestFirst() {
+	table := []struct {
+		name   string
+		input  []string
+		expect string
+	}{
+		{
+			name:   "no inputs",
+			expect: "",
+		},
+		{
+			name:   "all empty",
+			input:  []string{"", "", ""},
+			expect: "",
+		},
+		{
+			name:   "first populated",
+			input:  []string{"a", "b"},
+			expect: "a",
+		},
+		{
+			name:   "later populated",
+			input:  []string{"", "", "c", "d"},
+			expect: "c",
+		},
+	}
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			assert.Equal(suite.T(), test.expect, first(test.input...))
+		})
+	}
+}
+
+func (suite *SettingsUnitSuite) TestObscureForTest() {
+	singleMu.Lock()
+	prev := activeSensitiveInfoHandling
+	singleMu.Unlock()
+
+	defer func() {
+		singleMu.Lock()
+		setCluesSecretsHash(prev)
+		singleMu.Unlock()
+	}()
+
+	const secret = "hunter2"
+
+	table := []struct {
+		alg    sensitiveInfoHandlingAlgo
+		expect func(t *testing.T, obscured string)
+	}{
+		{
+			alg: ShowSensitiveInfoInPlainText,
+			expect: func(t *testing.T, obscured string) {
+				assert.Equal(t, secret, obscured)
+			},
+		},
+		{
+			alg: MaskSensitiveInfo,
+			expect: func(t *testing.T, obscured string) {
+				assert.Equal(t, "***", obscured)
+			},
+		},
+		{
+			alg: HashSensitiveInfo,
+			expect: func(t *testing.T, obscured string) {
+				assert.NotEmpty(t, obscured)
+				assert.NotContains(t, obscured, secret)
+				assert.Equal(t, obscured, ObscureForTest(secret), "deterministic")
+			},
+		},
+	}
+	for _, test := range table {
+		suite.Run(string(test.alg), func() {
+			t := suite.T()
+
+			singleMu.Lock()
+			setCluesSecretsHash(test.alg)
+			singleMu.Unlock()
+
+			obscured := ObscureForTest(secret)
+			test.expect(t, obscured)
+
+			ctx, logs := observedCtx(context.Background())
+			Ctx(ctx).With("password", clues.Hide(secret)).Info("login")
+
+			require.Equal(t, 1, logs.Len())
+			assert.Equal(t, obscured, logs.All()[0].ContextMap()["password"], "matches the log")
+		})
+	}
+}
+
+func (suite *SettingsUnitSuite) TestNoCreateDir() {
+	var (
+		t   = suite.T()
+		dir = filepath.Join(t.TempDir(), "missing")
+	)
+
+	t.Setenv(clogLogFileEnv, "")
+
+	resolved := ResolvedLogFile
+	ResolvedLogFile = ""
+
+	defaultLogFileDirMu.Lock()
+	prevDir := defaultLogFileDir
+	defaultLogFileDirMu.Unlock()
+
+	defer func() {
+		ResolvedLogFile = resolved
+		SetDefaultLogDir(prevDir)
+	}()
+
+	SetDefaultLogDir(dir)
+
+	set := Settings{NoCreateDir: true}.EnsureDefaults()
+	assert.Equal(t, Stderr, set.File)
+
+	_, err := os.Stat(dir)
+	assert.ErrorIs(t, err, os.ErrNotExist, "the log dir isn't created")
+
+	// an existing dir is used as-is.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "clog"), 0o755))
+
+	ResolvedLogFile = ""
+
+	set = Settings{NoCreateDir: true}.EnsureDefaults()
+	assert.True(t, strings.HasPrefix(set.File, dir+string(filepath.Separator)), set.File)
+}
+
+func (suite *SettingsUnitSuite) TestSetDefaultLogDir() {
+	var (
+		t   = suite.T()
+		dir = t.TempDir()
+	)
+
+	t.Setenv(clogLogFileEnv, "")
+
+	resolved := ResolvedLogFile
+	ResolvedLogFile = ""
+
+	defaultLogFileDirMu.Lock()
+	prevDir := defaultLogFileDir
+	defaultLogFileDirMu.Unlock()
+
+	defer func() {
+		ResolvedLogFile = resolved
+		SetDefaultLogDir(prevDir)
+	}()
+
+	SetDefaultLogDir(dir)
+
+	file := GetLogFileOrDefault("")
+	assert.True(t, strings.HasPrefix(file, dir+string(filepath.Separator)), file)
+
+	_, err := os.Stat(filepath.Dir(file))
+	assert.NoError(t, err, "the log dir gets created")
+}
+
+func (suite *SettingsUnitSuite) TestSetVerbosity() {
+	t := suite.T()
+
+	defer SetVerbosity(0)
+
+	set := Settings{Level: LevelInfo, Format: FormatToJSON}
+
+	SetVerbosity(1)
+
+	lines := logToFile(t, set, func(ctx context.Context) {
+		Ctx(ctx).Debug("debug")
+	})
+	require.Len(t, lines, 1)
+	assert.Equal(t, "debug", jsonLine(t, lines[0])["msg"])
+
+	SetVerbosity(-1)
+
+	lines = logToFile(t, set, func(ctx context.Context) {
+		Ctx(ctx).Info("info")
+		Ctx(ctx).Error("error")
+	})
+	require.Len(t, lines, 1)
+	assert.Equal(t, "error", jsonLine(t, lines[0])["msg"])
+
+	lines = logToFile(t, set, func(ctx context.Context) {
+		SetVerbosity(0)
+		Ctx(ctx).Info("live")
+	})
+	require.Len(t, lines, 1, "applies to loggers that are already built")
+	assert.Equal(t, "live", jsonLine(t, lines[0])["msg"])
+
+	SetVerbosity(1)
+
+	var (
+		bb       = &bytes.Buffer{}
+		disabled = Settings{
+			Level:  LevelDisabled,
+			Format: FormatToJSON,
+			Sinks:  []Sink{{Writer: bb, Level: LevelDisabled}},
+		}
+		ctx, zsl = InitWithWriter(context.Background(), disabled, bb)
+	)
+
+	defer Release(zsl)
+
+	Ctx(ctx).Error("error")
+	Flush(ctx)
+	assert.Empty(t, bb.String(), "disabled loggers stay disabled")
+}
+
+func (suite *SettingsUnitSuite) TestShiftLevel() {
+	table := []struct {
+		level  logLevel
+		delta  int
+		expect logLevel
+	}{
+		{LevelInfo, 0, LevelInfo},
+		{LevelInfo, 1, LevelDebug},
+		{LevelInfo, -1, LevelError},
+		{LevelInfo, 5, LevelDebug},
+		{LevelInfo, -5, LevelDisabled},
+		{LevelDisabled, 1, LevelDisabled},
+		{LevelDisabled, -1, LevelDisabled},
+	}
+	for _, test := range table {
+		suite.Run(fmt.Sprintf("%s_%d", test.level, test.delta), func() {
+			assert.Equal(suite.T(), test.expect, shiftLevel(test.level, test.delta))
+		})
+	}
+}
+
+func (suite *SettingsUnitSuite) TestSortKeys() {
+	t := suite.T()
+
+	lines := logToFile(
+		t,
+		Settings{Format: FormatToJSON, SortKeys: true},
+		func(ctx context.Context) {
+			ctx = clues.Add(ctx, "mango", 3)
+
+			Ctx(ctx).
+				With("zeta", 1, "alpha", 2, "kiwi", 4).
+				Info("sorted")
+		})
+	require.Len(t, lines, 1)
+
+	keys := []string{"alpha", "clog_comments", "clog_labels", "kiwi", "mango", "zeta"}
+	last := -1
+
+	for _, k := range keys {
+		idx := strings.Index(lines[0], `"`+k+`":`)
+		require.NotEqual(t, -1, idx, k)
+		assert.Greater(t, idx, last, "key order at "+k)
+
+		last = idx
+	}
+}
@@ -0,0 +1,63 @@
+package clog
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/alcionai/clues"
+)
+
+// ignoreBenignSyncErrs drops the errors that the console returns when it
+// gets synced, and keeps everything else.  Stdout and stderr can't be
+// synced when they point at a terminal or a pipe, so syncing them fails
+// with EINVAL, ENOTTY, or EBADF, depending on the platform.  Nothing got
+// lost, so those errors are noise.  Errors that combine several others
+// (ex: from syncing each sink) get filtered one by one.
+func ignoreBenignSyncErrs(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	multi, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		if benignSyncErr(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	var errs []error
+
+	for _, e := range multi.Unwrap() {
+		if e = ignoreBenignSyncErrs(e); e != nil {
+			errs = append(errs, e)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case len(multi.Unwrap()):
+		return err
+	default:
+		return clues.Stack(errs...).OrNil()
+	}
+}
+
+// benignSyncErr reports whether the error came from syncing the console.
+func benignSyncErr(err error) bool {
+	var pe *os.PathError
+	if !errors.As(err, &pe) {
+		return false
+	}
+
+	if pe.Path != os.Stdout.Name() && pe.Path != os.Stderr.Name() {
+		return false
+	}
+
+	return errors.Is(pe.Err, syscall.EINVAL) ||
+		errors.Is(pe.Err, syscall.ENOTTY) ||
+		errors.Is(pe.Err, syscall.EBADF)
+}
@@ -0,0 +1,99 @@
+package clog
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SyncErrUnitSuite struct {
+	suite.Suite
+}
+
+func TestSyncErrUnitSuite(t *testing.T) {
+	suite.Run(t, new(SyncErrUnitSuite))
+}
+
+func (suite *SyncErrUnitSuite) TestIgnoreBenignSyncErrs() {
+	var (
+		consoleErr = func(f *os.File, errno syscall.Errno) error {
+			return &os.PathError{Op: "sync", Path: f.Name(), Err: errno}
+		}
+		realErr = &os.PathError{Op: "sync", Path: "/var/log/app.log", Err: syscall.EIO}
+	)
+
+	table := []struct {
+		name      string
+		err       error
+		expectNil bool
+		expect    []error
+	}{
+		{
+			name:      "nil",
+			expectNil: true,
+		},
+		{
+			name:      "stdout einval",
+			err:       consoleErr(os.Stdout, syscall.EINVAL),
+			expectNil: true,
+		},
+		{
+			name:      "stderr enotty",
+			err:       consoleErr(os.Stderr, syscall.ENOTTY),
+			expectNil: true,
+		},
+		{
+			name:      "stderr ebadf",
+			err:       consoleErr(os.Stderr, syscall.EBADF),
+			expectNil: true,
+		},
+		{
+			name:   "real error",
+			err:    realErr,
+			expect: []error{realErr},
+		},
+		{
+			name:   "console with a real errno",
+			err:    consoleErr(os.Stdout, syscall.EIO),
+			expect: []error{syscall.EIO},
+		},
+		{
+			name:   "file with a benign errno",
+			err:    &os.PathError{Op: "sync", Path: "/var/log/app.log", Err: syscall.EINVAL},
+			expect: []error{syscall.EINVAL},
+		},
+		{
+			name:      "all benign",
+			err:       errors.Join(consoleErr(os.Stdout, syscall.ENOTTY), consoleErr(os.Stderr, syscall.EINVAL)),
+			expectNil: true,
+		},
+		{
+			name:   "benign and real",
+			err:    errors.Join(consoleErr(os.Stderr, syscall.ENOTTY), realErr),
+			expect: []error{realErr},
+		},
+	}
+	for _, test := range table {
+		suite.Run(test.name, func() {
+			t := suite.T()
+			err := ignoreBenignSyncErrs(test.err)
+
+			if test.expectNil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.Error(t, err)
+
+			for _, e := range test.expect {
+				assert.ErrorIs(t, err, e)
+			}
+
+			assert.NotErrorIs(t, err, syscall.ENOTTY, "benign errors are dropped")
+		})
+	}
+}
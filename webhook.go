@@ -0,0 +1,265 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alcionai/clues"
+	"go.uber.org/zap/zapcore"
+)
+
+// compliance guarantees
+var _ zapcore.WriteSyncer = &WebhookSink{}
+
+// WebhookSink POSTs logs to a webhook, ex: for alerting on errors without
+// standing up a separate log shipper.  Logs get batched and sent as a json
+// array of log objects.  Writes never block the logging path: logs sit in a
+// bounded queue until they're sent, and get dropped if the queue is full.
+//
+// Add it to the Settings.Sinks by way of WebhookSink.Sink():
+//
+//	wh := &clog.WebhookSink{URL: "https://hooks.example.com/alerts"}
+//	set.Sinks = append(set.Sinks, wh.Sink())
+//
+// Call Close once logging is done to stop the sender.
+type WebhookSink struct {
+	// where to POST the logs.
+	URL string
+	// the minimum level of the logs that get sent.  Defaults to error.
+	MinLevel logLevel
+	// the timeout for each POST.  Defaults to 5 seconds.
+	Timeout time.Duration
+
+	// the maximum number of logs sent in each POST.  Defaults to 10.
+	BatchSize int
+	// the number of logs that can wait to get sent before further logs
+	// get dropped.  Defaults to 100.
+	QueueSize int
+	// the number of times a failed POST gets retried.  Defaults to 3.
+	Retries int
+	// how often queued logs get sent, even if the batch isn't full.
+	// Defaults to 1 second.
+	FlushInterval time.Duration
+	// the client used to make the POSTs.  Defaults to http.DefaultClient.
+	Client *http.Client
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	queue     chan []byte
+	flushReq  chan chan struct{}
+	stop      chan struct{}
+	stopped   chan struct{}
+	closed    atomic.Bool
+	dropped   atomic.Int64
+}
+
+// Sink produces a json-formatted Sink that writes to the webhook at the
+// webhook's MinLevel.
+func (ws *WebhookSink) Sink() Sink {
+	level := ws.MinLevel
+	if len(level) == 0 {
+		level = LevelError
+	}
+
+	return Sink{
+		Writer: ws,
+		Format: FormatToJSON,
+		Level:  level,
+	}
+}
+
+// Dropped returns the number of logs that never reached the webhook,
+// either because the queue was full, or because the POST kept failing.
+func (ws *WebhookSink) Dropped() int64 {
+	return ws.dropped.Load()
+}
+
+// Write queues the log to get sent.  Never blocks; if the queue is full,
+// the log gets dropped.
+func (ws *WebhookSink) Write(p []byte) (int, error) {
+	ws.start()
+
+	if ws.closed.Load() {
+		ws.dropped.Add(1)
+		return len(p), nil
+	}
+
+	// zap re-uses the buffer once the write returns.
+	rec := bytes.TrimRight(bytes.Clone(p), "\n")
+
+	select {
+	case ws.queue <- rec:
+	default:
+		ws.dropped.Add(1)
+	}
+
+	return len(p), nil
+}
+
+// Sync sends all of the queued logs, and waits until they're sent.
+func (ws *WebhookSink) Sync() error {
+	ws.start()
+
+	if ws.closed.Load() {
+		return nil
+	}
+
+	done := make(chan struct{})
+
+	select {
+	case ws.flushReq <- done:
+		<-done
+	case <-ws.stopped:
+	}
+
+	return nil
+}
+
+// Close sends all of the queued logs, then stops the sender.  Logs written
+// after closing get dropped.
+func (ws *WebhookSink) Close() error {
+	ws.start()
+
+	ws.stopOnce.Do(func() {
+		ws.closed.Store(true)
+		close(ws.stop)
+	})
+
+	<-ws.stopped
+
+	return nil
+}
+
+func (ws *WebhookSink) start() {
+	ws.startOnce.Do(func() {
+		ws.queue = make(chan []byte, orDefault(ws.QueueSize, 100))
+		ws.flushReq = make(chan chan struct{})
+		ws.stop = make(chan struct{})
+		ws.stopped = make(chan struct{})
+
+		go ws.run()
+	})
+}
+
+// run batches up the queued logs and sends them, until stopped.
+func (ws *WebhookSink) run() {
+	defer close(ws.stopped)
+
+	var (
+		batchSize = orDefault(ws.BatchSize, 10)
+		ticker    = time.NewTicker(orDefault(ws.FlushInterval, time.Second))
+		batch     = make([][]byte, 0, batchSize)
+	)
+
+	defer ticker.Stop()
+
+	send := func() {
+		if len(batch) > 0 {
+			ws.post(batch)
+			batch = batch[:0]
+		}
+	}
+
+	// drain moves everything in the queue into batches.
+	drain := func() {
+		for {
+			select {
+			case rec := <-ws.queue:
+				batch = append(batch, rec)
+
+				if len(batch) >= batchSize {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case rec := <-ws.queue:
+			batch = append(batch, rec)
+
+			if len(batch) >= batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-ws.flushReq:
+			drain()
+			close(done)
+		case <-ws.stop:
+			drain()
+			return
+		}
+	}
+}
+
+// post sends the batch as a json array, retrying on failure.
+func (ws *WebhookSink) post(batch [][]byte) {
+	body := append([]byte("["), bytes.Join(batch, []byte(","))...)
+	body = append(body, ']')
+
+	var (
+		client  = ws.Client
+		retries = orDefault(ws.Retries, 3)
+	)
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * 100 * time.Millisecond)
+		}
+
+		if err := ws.send(client, body); err == nil {
+			return
+		}
+	}
+
+	ws.dropped.Add(int64(len(batch)))
+}
+
+func (ws *WebhookSink) send(client *http.Client, body []byte) error {
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		orDefault(ws.Timeout, 5*time.Second))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ws.URL, bytes.NewReader(body))
+	if err != nil {
+		return clues.Wrap(err, "building webhook request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return clues.Wrap(err, "posting to webhook")
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return clues.New("webhook rejected the logs").With("status_code", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// orDefault returns v, or the default if v isn't positive.
+func orDefault[T int | time.Duration](v, def T) T {
+	if v <= 0 {
+		return def
+	}
+
+	return v
+}
@@ -0,0 +1,97 @@
+package clog
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alcionai/clues"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// the zap sink scheme used for io.Writers.
+const writerScheme = "clogwriter"
+
+// zap only builds sinks from urls, so writers get parked here under an id
+// until the logger opens the sink for that id.
+var (
+	writerSinksMu sync.Mutex
+	writerSinks   = map[string]io.Writer{}
+	writerSinkID  int
+)
+
+func init() {
+	err := zap.RegisterSink(writerScheme, func(u *url.URL) (zap.Sink, error) {
+		writerSinksMu.Lock()
+		defer writerSinksMu.Unlock()
+
+		w, ok := writerSinks[u.Host]
+		if !ok {
+			return nil, clues.New("no writer registered for the sink").With("sink_id", u.Host)
+		}
+
+		delete(writerSinks, u.Host)
+
+		return writerSink{zapcore.Lock(zapcore.AddSync(w))}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// writerPath parks the writer, and produces the zap output path that
+// opens a sink for it.  Each path can only get opened once.
+func writerPath(w io.Writer) string {
+	writerSinksMu.Lock()
+	defer writerSinksMu.Unlock()
+
+	writerSinkID++
+	id := strconv.Itoa(writerSinkID)
+	writerSinks[id] = w
+
+	return writerScheme + "://" + id
+}
+
+func isWriterPath(file string) bool {
+	return strings.HasPrefix(file, writerScheme+"://")
+}
+
+// writerSink adapts an io.Writer into a zap.Sink.  Closing the sink leaves
+// the writer open; it belongs to the caller.
+type writerSink struct {
+	zapcore.WriteSyncer
+}
+
+func (ws writerSink) Close() error {
+	return nil
+}
+
+// InitWithWriter embeds a logger that writes to w within the context.  The
+// format, level, and all other settings apply as usual, except for the File,
+// which gets ignored.  The json array format falls back to json.  Unlike
+// Init, this doesn't touch the singleton; logs only reach w when they come
+// from the returned ctx (or its children), or the returned zap logger.  As
+// with New, the SensitiveInfoHandling only gets applied if it's specified.
+// Pass the returned zap logger to Release once you're done with it.
+func InitWithWriter(
+	ctx context.Context,
+	set Settings,
+	w io.Writer,
+) (context.Context, *zap.SugaredLogger) {
+	set.File = writerPath(w)
+	set = standaloneSettings(set)
+
+	var (
+		clgr = newClogger(genLogger(set), set)
+		// the builder's caller skip doesn't apply to direct use of the zsl.
+		zsl = clgr.zsl.WithOptions(zap.AddCallerSkip(-2))
+	)
+
+	trackLogger(zsl, clgr)
+
+	return plantLoggerInCtx(ctx, clgr), zsl
+}